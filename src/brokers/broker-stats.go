@@ -4,6 +4,7 @@ package brokers
 // monitor load balance, and the number of topics balance on broker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 	"github.com/pkg/errors"
 )
@@ -196,18 +198,29 @@ func QueryTopicStats(url, token string) error {
 }
 
 // TestBrokers evaluates all brokers' health
-func TestBrokers(urlPrefix, clusterName, token string) (int, error) {
+// The run is traced with the spans of the brokers query and every broker health check and topic stats query.
+func TestBrokers(ctx context.Context, urlPrefix, clusterName, token string) (failedBrokers int, err error) {
+	ctx, span := otlp.Start(ctx, "brokers health", otlp.String("pulsar.cluster", clusterName))
+	defer func() {
+		span.SetAttributes(otlp.Int("failed.brokers", failedBrokers))
+		span.EndWithError(err)
+	}()
+
+	_, brokersSpan := otlp.Start(ctx, "get brokers")
 	brokers, err := GetBrokers(urlPrefix, clusterName, token)
+	brokersSpan.EndWithError(err)
 	if err != nil {
 		return 0, err
 	}
 
 	log.Debugf("got a list of brokers %v", brokers)
-	failedBrokers := 0
 	errStr := ""
 	for _, brokerURL := range brokers {
 		// check the broker health
-		if err := BrokerHealthCheck(brokerURL, token); err != nil {
+		_, healthSpan := otlp.Start(ctx, "health check", otlp.String("pulsar.broker", brokerURL))
+		err := BrokerHealthCheck(brokerURL, token)
+		healthSpan.EndWithError(err)
+		if err != nil {
 			errStr = errStr + ";;" + err.Error()
 			failedBrokers++
 			continue
@@ -234,7 +247,9 @@ func TestBrokers(urlPrefix, clusterName, token string) (int, error) {
 				continue
 			}
 			url = util.SingleSlashJoin(util.SingleSlashJoin(urlPrefix, "/admin/v2/"), url+"/stats")
+			_, statsSpan := otlp.Start(ctx, "topic stats", otlp.String("pulsar.broker", brokerURL))
 			err = QueryTopicStats(url, token)
+			statsSpan.EndWithError(err)
 			if err != nil {
 				errStr = errStr + ";;" + err.Error()
 				failureCount++
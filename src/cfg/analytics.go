@@ -209,9 +209,17 @@ func sendToInsights(data interface{}) {
 	}
 }
 
+func sendEventAsync(eventType, userID, deviceID string, eventProp map[string]interface{}) {
+	notifyAsync(func() { sendEvent(eventType, userID, deviceID, eventProp) })
+}
+
+func sendToInsightsAsync(data interface{}) {
+	notifyAsync(func() { sendToInsights(data) })
+}
+
 // AnalyticsReportIncident reports the beginning of an incident
 func AnalyticsReportIncident(deviceID, alias, message, description string) {
-	go sendEvent(reportIncident, deviceID, deviceID, map[string]interface{}{
+	sendEventAsync(reportIncident, deviceID, deviceID, map[string]interface{}{
 		"cluster":     deviceID,
 		"alias":       alias,
 		"message":     message,
@@ -220,7 +228,7 @@ func AnalyticsReportIncident(deviceID, alias, message, description string) {
 		"timestamp":   time.Now(),
 	})
 
-	go sendToInsights(ReportIncidentEvent{
+	sendToInsightsAsync(ReportIncidentEvent{
 		EventType:   reportIncident,
 		Timestamp:   time.Now(),
 		Cluster:     deviceID,
@@ -235,14 +243,14 @@ func AnalyticsReportIncident(deviceID, alias, message, description string) {
 
 // AnalyticsClearIncident reports the end of an incident
 func AnalyticsClearIncident(deviceID string, downtimeSeconds int) {
-	go sendEvent(clearIncident, deviceID, deviceID, map[string]interface{}{
+	sendEventAsync(clearIncident, deviceID, deviceID, map[string]interface{}{
 		"cluster":         deviceID,
 		"reportedBy":      "pulsar monitor",
 		"timestamp":       time.Now(),
 		"downtimeSeconds": downtimeSeconds,
 	})
 
-	go sendToInsights(ClearIncidentEvent{
+	sendToInsightsAsync(ClearIncidentEvent{
 		EventType:       clearIncident,
 		Timestamp:       time.Now(),
 		Cluster:         deviceID,
@@ -254,13 +262,13 @@ func AnalyticsClearIncident(deviceID string, downtimeSeconds int) {
 
 // AnalyticsAppStart reports a monitor starts
 func AnalyticsAppStart(deviceID string) {
-	go sendEvent(appStart, deviceID, deviceID, map[string]interface{}{
+	sendEventAsync(appStart, deviceID, deviceID, map[string]interface{}{
 		"cluster":   deviceID,
 		"name":      "pulsar monitor",
 		"timestamp": time.Now(),
 	})
 
-	go sendToInsights(AppStartEvent{
+	sendToInsightsAsync(AppStartEvent{
 		EventType: appStart,
 		Timestamp: time.Now(),
 		Cluster:   deviceID,
@@ -268,7 +276,7 @@ func AnalyticsAppStart(deviceID string) {
 		AppName:   "pulsar monitor",
 	})
 
-	go sendToInsights(ClearIncidentEvent{
+	sendToInsightsAsync(ClearIncidentEvent{
 		EventType:       clearIncident,
 		Timestamp:       time.Now(),
 		Cluster:         deviceID,
@@ -280,7 +288,7 @@ func AnalyticsAppStart(deviceID string) {
 
 // AnalyticsLatencyReport reports a monitor starts
 func AnalyticsLatencyReport(deviceID, name, errorMessage string, latency int, inOrderDelivery, withinLatencyBudget bool) {
-	go sendEvent(latencyReport, deviceID, deviceID, map[string]interface{}{
+	sendEventAsync(latencyReport, deviceID, deviceID, map[string]interface{}{
 		"cluster":             deviceID,
 		"catetory":            "pulsar pub sub latency",
 		"name":                name,
@@ -291,7 +299,7 @@ func AnalyticsLatencyReport(deviceID, name, errorMessage string, latency int, in
 		"error":               errorMessage,
 	})
 
-	go sendToInsights(LatencyReportEvent{
+	sendToInsightsAsync(LatencyReportEvent{
 		EventType:           latencyReport,
 		Timestamp:           time.Now(),
 		Cluster:             deviceID,
@@ -306,7 +314,7 @@ func AnalyticsLatencyReport(deviceID, name, errorMessage string, latency int, in
 
 // AnalyticsHeartbeat reports heartbeat
 func AnalyticsHeartbeat(deviceID string) {
-	go sendToInsights(HeartbeatEvent{
+	sendToInsightsAsync(HeartbeatEvent{
 		EventType: heartBeat,
 		Timestamp: time.Now(),
 		Cluster:   deviceID,
@@ -316,7 +324,7 @@ func AnalyticsHeartbeat(deviceID string) {
 
 // AnalyticsDowntime reports downtime
 func AnalyticsDowntime(deviceID string, downtimeSeconds int) {
-	go sendToInsights(DowntimeReportEvent{
+	sendToInsightsAsync(DowntimeReportEvent{
 		EventType:       downtimeReport,
 		Timestamp:       time.Now(),
 		Cluster:         deviceID,
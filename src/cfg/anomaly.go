@@ -0,0 +1,73 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/stats"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+// detectorOptions returns the options of the anomaly detector of a probe in the timezone
+// The window of the sigma detector defaults to the latencyWindowConfig.
+func (c AnomalyDetectorCfg) detectorOptions(timezone string) stats.DetectorOptions {
+	window := stats.WindowOptions{}
+	if c.Type == "" || strings.EqualFold(c.Type, stats.DetectorSigma) {
+		window = GetConfig().LatencyWindowConfig.windowOptions()
+	}
+	if c.WindowSize > 0 {
+		window.Size = c.WindowSize
+	}
+	if c.MinSamples > 0 {
+		window.MinSamples = c.MinSamples
+	}
+	opts := stats.DetectorOptions{
+		Type:      c.Type,
+		Threshold: c.Threshold,
+		Alpha:     c.Alpha,
+		Window:    window,
+	}
+	if loc, err := time.LoadLocation(timezone); err == nil {
+		opts.Location = loc
+	}
+	return opts
+}
+
+// latencyDetector returns the anomaly detector of the probe by the probe id, the latency samples are in μs
+func latencyDetector(key string, c AnomalyDetectorCfg, timezone string) stats.Detector {
+	d, err := util.GetDetector(key, c.detectorOptions(timezone))
+	if err != nil {
+		log.Errorf("probe %s anomaly detector error %v", key, err)
+		return nil
+	}
+	return d
+}
+
+// latencyAnomaly evaluates the latency with the anomaly detector of the probe
+// It returns the probe error of an anomaly, or nil if the latency is within the baseline.
+// The failure reason of every detector type is stddev_anomaly, the reason of the σ detector that predates the others.
+func latencyAnomaly(key string, c AnomalyDetectorCfg, timezone string, latency time.Duration) error {
+	d := latencyDetector(key, c, timezone)
+	if d == nil {
+		return nil
+	}
+	v := d.Push(float64(latency.Microseconds()), time.Now())
+	if !v.Anomaly {
+		return nil
+	}
+	return probeError(reasonStddevAnomaly, fmt.Errorf("latency %v is %.1f deviations of %v over the %s baseline %v",
+		latency, v.Score, microseconds(v.Deviation), util.AssignString(c.Type, stats.DetectorSigma), microseconds(v.Baseline)))
+}
+
+// addLatency adds the latency to the baseline of the probe without evaluation
+func addLatency(key string, c AnomalyDetectorCfg, timezone string, latency time.Duration) {
+	if d := latencyDetector(key, c, timezone); d != nil {
+		d.Add(float64(latency.Microseconds()), time.Now())
+	}
+}
+
+func microseconds(us float64) time.Duration {
+	return time.Duration(us * float64(time.Microsecond)).Round(time.Microsecond)
+}
@@ -0,0 +1,97 @@
+package cfg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLatencyAnomaly(t *testing.T) {
+	saved := GetConfig()
+	defer setConfig(saved)
+	setConfig(&Configuration{LatencyWindowConfig: LatencyWindowCfg{MinSamples: 5}})
+
+	detector := AnomalyDetectorCfg{Type: "mad"}
+	key := ProbeTypePubSub + "/anomaly-test"
+	addLatency(key, detector, "America/New_York", time.Second)
+	for i := 0; i < 20; i++ {
+		err := latencyAnomaly(key, detector, "America/New_York", time.Duration(10+i%3)*time.Millisecond)
+		assert(t, err == nil, "normal latency %v", err)
+	}
+	err := latencyAnomaly(key, detector, "America/New_York", 200*time.Millisecond)
+	assert(t, reasonStddevAnomaly == probeErrorReason(err), "latency anomaly reason %v", err)
+	assert(t, strings.HasPrefix(err.Error(), "latency 200ms is ") && strings.HasSuffix(err.Error(), "over the mad baseline 11ms"),
+		"anomaly message %v", err)
+
+	// the sigma detector falls back to the latency window of the configuration
+	sigma := AnomalyDetectorCfg{}
+	opts := sigma.detectorOptions("")
+	assert(t, 5 == opts.Window.MinSamples && "UTC" == opts.Location.String(), "sigma detector options %+v", opts)
+	assert(t, 0 == detector.detectorOptions("").Window.MinSamples, "the other detectors have their own defaults")
+}
+
+func TestTopicLatencyAnomalyFailure(t *testing.T) {
+	saved := GetConfig()
+	defer setConfig(saved)
+	setConfig(&Configuration{})
+	defer reconcileProbes(nil)
+
+	topicCfg := TopicCfg{
+		Name:            "anomaly-topic",
+		TopicName:       "persistent://public/default/anomaly",
+		LatencyBudgetMs: 1000,
+		AnomalyDetector: AnomalyDetectorCfg{Type: "mad", MinSamples: 5},
+	}
+	for i := 0; i < 10; i++ {
+		reportTopicLatency(context.Background(), "anomaly-cluster", topicCfg,
+			MsgResult{InOrderDelivery: true, Latency: time.Duration(10+i%3) * time.Millisecond}, nil)
+	}
+	reportTopicLatency(context.Background(), "anomaly-cluster", topicCfg, MsgResult{InOrderDelivery: true, Latency: 500 * time.Millisecond}, nil)
+
+	failures := counterVec(ProbeFailuresCounterOpt(), []string{"probe", "type", "reason"})
+	assert(t, 1 == testutil.ToFloat64(failures.WithLabelValues("anomaly-topic", ProbeTypePubSub, reasonStddevAnomaly)),
+		"a pubsub latency anomaly is a probe failure")
+	successes := counterVec(ProbeSuccessesCounterOpt(), []string{"probe", "type"})
+	assert(t, 10 == testutil.ToFloat64(successes.WithLabelValues("anomaly-topic", ProbeTypePubSub)), "probe successes")
+}
+
+func TestTopicPercentileLatencyAnomaly(t *testing.T) {
+	saved := GetConfig()
+	defer setConfig(saved)
+	setConfig(&Configuration{})
+	defer reconcileProbes(nil)
+
+	topicCfg := TopicCfg{
+		Name:                    "percentile-anomaly-topic",
+		TopicName:               "persistent://public/default/percentile-anomaly",
+		LatencyBudgetMs:         1000,
+		LatencyBudgetPercentile: "p99",
+		AnomalyDetector:         AnomalyDetectorCfg{Type: "mad", MinSamples: 5},
+	}
+	result := func(p99 time.Duration) MsgResult {
+		return MsgResult{InOrderDelivery: true, Latency: 10 * time.Millisecond, Percentiles: LatencyPercentiles{P99: p99}}
+	}
+	for i := 0; i < 10; i++ {
+		reportTopicLatency(context.Background(), "percentile-cluster", topicCfg, result(time.Duration(20+i%3)*time.Millisecond), nil)
+	}
+	// the mean is steady, the anomaly is in the percentile of the budget
+	reportTopicLatency(context.Background(), "percentile-cluster", topicCfg, result(500*time.Millisecond), nil)
+
+	failures := counterVec(ProbeFailuresCounterOpt(), []string{"probe", "type", "reason"})
+	assert(t, 1 == testutil.ToFloat64(failures.WithLabelValues("percentile-anomaly-topic", ProbeTypePubSub, reasonStddevAnomaly)),
+		"the budget percentile latency is evaluated by the anomaly detector")
+}
+
+func TestRemovedProbeDetector(t *testing.T) {
+	defer reconcileProbes(nil)
+	key := probeID(ProbeTypeWebSocket, "removed-websocket")
+	reconcileProbes([]*Probe{{Name: "removed-websocket", Type: ProbeTypeWebSocket, Interval: time.Hour, run: func(ctx context.Context) {}}})
+	d := latencyDetector(key, AnomalyDetectorCfg{Type: "mad"}, "")
+	assert(t, d == latencyDetector(key, AnomalyDetectorCfg{Type: "mad"}, ""), "the baseline is kept between the runs")
+
+	reconcileProbes(nil)
+	assert(t, d != latencyDetector(key, AnomalyDetectorCfg{Type: "mad"}, ""), "the baseline of a removed probe is deleted")
+}
@@ -0,0 +1,179 @@
+package cfg
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// admin REST API to inspect open incidents, alert policy counters, probe results and to manage silences
+
+const (
+	apiPrefix       = "/api/v1"
+	silencesAPIPath = apiPrefix + "/silences"
+)
+
+// RegisterAdminAPI registers the admin REST API handlers
+func RegisterAdminAPI(mux *http.ServeMux) {
+	mux.HandleFunc(apiPrefix+"/incidents", getOnly(incidentsHandler))
+	mux.HandleFunc(apiPrefix+"/policies", getOnly(policiesHandler))
+	mux.HandleFunc(apiPrefix+"/probes", getOnly(probesHandler))
+	mux.HandleFunc(apiPrefix+"/probes/run", runProbeHandler)
+	mux.HandleFunc(silencesAPIPath, silencesHandler)
+	mux.HandleFunc(silencesAPIPath+"/", silenceHandler)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("failed to write api response %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// authorized validates the bearer token of a request
+// An endpoint that is required to be authenticated is disabled if the token is not configured,
+// the other endpoints are public without the token.
+func authorized(w http.ResponseWriter, r *http.Request, required bool) bool {
+	token := GetConfig().AdminAPIConfig.Token
+	if token == "" {
+		if required {
+			writeError(w, http.StatusForbidden, fmt.Errorf("the endpoint is disabled since adminApiConfig token is not configured"))
+		}
+		return !required
+	}
+	header := r.Header.Get("Authorization")
+	bearer := strings.TrimPrefix(header, "Bearer ")
+	if bearer == header || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid bearer token"))
+		return false
+	}
+	return true
+}
+
+// getOnly serves the GET requests, they are authenticated if the token is configured
+func getOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+			return
+		}
+		if !authorized(w, r, false) {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, GetIncidents())
+}
+
+func policiesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, GetPolicyStatuses())
+}
+
+func probesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, GetProbeStatuses())
+}
+
+// silencesHandler lists silences with GET and creates a silence with POST
+func silencesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !authorized(w, r, false) {
+			return
+		}
+		writeJSON(w, http.StatusOK, GetSilences())
+	case http.MethodPost:
+		if !authorized(w, r, true) {
+			return
+		}
+		silence := Silence{}
+		if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid silence %v", err))
+			return
+		}
+		silence.ID = ""
+		created, err := AddSilence(silence)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	}
+}
+
+// silenceHandler deletes a silence by id, i.e. DELETE /api/v1/silences/{id}
+func silenceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	if !authorized(w, r, true) {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, silencesAPIPath+"/")
+	if !RemoveSilence(id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("silence %s is not found", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runProbeHandler runs a probe immediately and returns its result, i.e. POST /api/v1/probes/run?name=&type=
+// The type is only required if the probes of several types have the name.
+func runProbeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	if !authorized(w, r, true) {
+		return
+	}
+	name, probeType := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+	matched := findProbes(probeType, name)
+	if len(matched) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("probe %s is not found", name))
+		return
+	}
+	if len(matched) > 1 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("probe %s has %d types, the type is required", name, len(matched)))
+		return
+	}
+	p := matched[0]
+	log.Infof("run %s probe %s on demand", p.Type, p.Name)
+	status, err := p.Run()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// findProbes returns the registered probes of the name, of any type if the type is empty
+func findProbes(probeType, name string) []*Probe {
+	if probeType != "" {
+		if p, ok := GetProbe(probeType, name); ok {
+			return []*Probe{p}
+		}
+		return nil
+	}
+	matched := []*Probe{}
+	for _, p := range GetProbes() {
+		if p.Name == name {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,140 @@
+package cfg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminAPI(t *testing.T) {
+	sink := &testSink{}
+	defer useTestSinks(sink)()
+	mux := http.NewServeMux()
+	RegisterAdminAPI(mux)
+
+	serve := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	policy := AlertPolicyCfg{Ceiling: 1}
+	ReportIncident("api-component", "api-cluster", "failure", "description", &policy)
+	defer ClearIncident("api-component")
+	recordProbeResult("api-probe", ProbeTypeSite, 20*time.Millisecond, errors.New("timed out"))
+
+	rec := serve(http.MethodGet, "/api/v1/incidents", nil)
+	assert(t, http.StatusOK == rec.Code, "list incidents")
+	incidentList := []IncidentStatus{}
+	errNil(t, json.Unmarshal(rec.Body.Bytes(), &incidentList))
+	found := false
+	for _, v := range incidentList {
+		found = found || ("api-component" == v.Component && "ref-api-component" == v.Refs["test"])
+	}
+	assert(t, found, "open incident with the sink reference")
+
+	rec = serve(http.MethodGet, "/api/v1/policies", nil)
+	policies := []PolicyStatus{}
+	errNil(t, json.Unmarshal(rec.Body.Bytes(), &policies))
+	found = false
+	for _, v := range policies {
+		found = found || ("api-component" == v.Component && StateFiring == v.State)
+	}
+	assert(t, found, "alert policy state of the component")
+
+	rec = serve(http.MethodGet, "/api/v1/probes", nil)
+	probes := []ProbeStatus{}
+	errNil(t, json.Unmarshal(rec.Body.Bytes(), &probes))
+	found = false
+	for _, v := range probes {
+		found = found || ("api-probe" == v.Name && !v.Healthy && "timed out" == v.Error && 20 == v.LatencyMs)
+	}
+	assert(t, found, "last probe result")
+	assert(t, http.StatusMethodNotAllowed == serve(http.MethodPost, "/api/v1/probes", nil).Code, "probes are read only")
+
+	body, _ := json.Marshal(Silence{Matchers: SilenceMatcher{Component: "api-*"}, EndsAt: time.Now().Add(time.Hour)})
+	assert(t, http.StatusForbidden == serve(http.MethodPost, "/api/v1/silences", body).Code, "silences are read only without a token")
+	assert(t, http.StatusForbidden == serve(http.MethodDelete, "/api/v1/silences/any", nil).Code, "silences cannot be deleted without a token")
+	GetConfig().AdminAPIConfig.Token = "secret"
+	defer func() { GetConfig().AdminAPIConfig.Token = "" }()
+
+	rec = serve(http.MethodPost, "/api/v1/silences", []byte(`{"matchers":{"component":"api-*"}}`))
+	assert(t, http.StatusBadRequest == rec.Code, "silence without end time is rejected")
+	rec = serve(http.MethodPost, "/api/v1/silences", body)
+	assert(t, http.StatusCreated == rec.Code, "create silence")
+	silence := Silence{}
+	errNil(t, json.Unmarshal(rec.Body.Bytes(), &silence))
+	assert(t, "" != silence.ID, "silence id is assigned")
+	assert(t, IsSilenced("api-component"), "component is silenced")
+
+	rec = serve(http.MethodGet, "/api/v1/silences", nil)
+	silenceList := []Silence{}
+	errNil(t, json.Unmarshal(rec.Body.Bytes(), &silenceList))
+	assert(t, 1 == len(silenceList) && silence.ID == silenceList[0].ID, "list silences")
+
+	assert(t, http.StatusNoContent == serve(http.MethodDelete, "/api/v1/silences/"+silence.ID, nil).Code, "delete silence")
+	assert(t, http.StatusNotFound == serve(http.MethodDelete, "/api/v1/silences/"+silence.ID, nil).Code, "silence is already deleted")
+	assert(t, !IsSilenced("api-component"), "component is no longer silenced")
+
+	// the read only endpoints require the token once it is configured
+	for _, target := range []string{"/api/v1/incidents", "/api/v1/policies", "/api/v1/probes", "/api/v1/silences"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert(t, http.StatusUnauthorized == rec.Code, "%s requires the token", target)
+	}
+}
+
+func TestRunProbeAPI(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterAdminAPI(mux)
+	serve := func(target, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	runs := 0
+	RegisterProbe("api-trigger", ProbeTypeSite, time.Minute, func(ctx context.Context) {
+		runs++
+		recordProbeResult("api-trigger", ProbeTypeSite, 5*time.Millisecond, nil)
+	})
+
+	assert(t, http.StatusForbidden == serve("/api/v1/probes/run?name=api-trigger", "").Code, "trigger is disabled without a token")
+	GetConfig().AdminAPIConfig.Token = "secret"
+	defer func() { GetConfig().AdminAPIConfig.Token = "" }()
+	assert(t, http.StatusUnauthorized == serve("/api/v1/probes/run?name=api-trigger", "wrong").Code, "invalid token is rejected")
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/probes/run?name=api-trigger", nil)
+	req.Header.Set("Authorization", "secret")
+	mux.ServeHTTP(rec, req)
+	assert(t, http.StatusUnauthorized == rec.Code, "the token requires the Bearer scheme")
+	assert(t, http.StatusNotFound == serve("/api/v1/probes/run?name=unknown", "secret").Code, "unknown probe")
+	assert(t, 0 == runs, "probe is not run by rejected requests")
+
+	rec = serve("/api/v1/probes/run?name=api-trigger", "secret")
+	assert(t, http.StatusOK == rec.Code, "probe is triggered")
+	status := ProbeStatus{}
+	errNil(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert(t, 1 == runs && "api-trigger" == status.Name && status.Healthy && 1 == status.Runs, "probe result is returned synchronously")
+
+	// the type selects one of the probes with the name
+	RegisterProbe("api-trigger", ProbeTypeTenants, time.Minute, func(ctx context.Context) {})
+	defer func() {
+		probesLock.Lock()
+		delete(probes, probeID(ProbeTypeTenants, "api-trigger"))
+		probesLock.Unlock()
+	}()
+	assert(t, http.StatusBadRequest == serve("/api/v1/probes/run?name=api-trigger", "secret").Code, "the type is required for an ambiguous name")
+	assert(t, http.StatusOK == serve("/api/v1/probes/run?name=api-trigger&type=site", "secret").Code && 2 == runs, "probe is triggered by type and name")
+}
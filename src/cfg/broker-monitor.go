@@ -1,6 +1,7 @@
 package cfg
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -10,12 +11,19 @@ import (
 )
 
 // EvaluateBrokers evaluates and reports all brokers health
-func EvaluateBrokers(prefixURL, token string) error {
+func EvaluateBrokers(ctx context.Context, prefixURL, token string) error {
 	name := GetConfig().Name + "-brokers" // again this is for in-cluster monitoring only
 
 	brokerCfg := GetConfig().BrokersConfig
 	clusterName := util.AssignString(GetConfig().ClusterName, GetConfig().Name)
-	failedBrokers, err := brokers.TestBrokers(prefixURL, clusterName, token)
+	registerProbeComponent(name, clusterName, ProbeTypeBroker)
+	start := time.Now()
+	failedBrokers, err := brokers.TestBrokers(ctx, prefixURL, clusterName, token)
+	if failedBrokers > 0 {
+		recordProbeResult(name, ProbeTypeBroker, time.Since(start), probeError(reasonUnhealthy, fmt.Errorf("%d unhealthy brokers, error %v", failedBrokers, err)))
+	} else {
+		recordProbeResult(name, ProbeTypeBroker, time.Since(start), probeError(reasonConnect, err))
+	}
 
 	if failedBrokers > 0 {
 		errMsg := fmt.Sprintf("cluster %s has %d unhealthy brokers, error message %v", name, failedBrokers, err)
@@ -32,6 +40,14 @@ func EvaluateBrokers(prefixURL, token string) error {
 
 // MonitorBrokers start K8sPulsarClusterMonitor thread
 func MonitorBrokers() error {
+	for _, p := range registerBrokersProbes() {
+		log.Infof("start all brokers monitoring every %v...", p.Interval)
+		scheduleProbe(p, false)
+	}
+	return nil
+}
+
+func registerBrokersProbes() []*Probe {
 	token := GetConfig().Token
 	if token == "" {
 		log.Infof("MonitorBroker exits since no token is specified")
@@ -44,19 +60,18 @@ func MonitorBrokers() error {
 		return nil
 	}
 
-	interval := util.TimeDuration(GetConfig().BrokersConfig.IntervalSeconds, 60, time.Second)
-
-	go func(restURL, jwt string, loopInterval time.Duration) {
-		log.Infof("start all brokers monitoring every %v...", loopInterval)
-		ticker := time.NewTicker(loopInterval)
-		for {
-			select {
-			case <-ticker.C:
-				if err := EvaluateBrokers(restURL, jwt); err != nil {
-					log.Errorf("pulsar brokers monitoring failed, error: %v", err)
-				}
+	name := GetConfig().Name + "-brokers"
+	p := registerProbe(&Probe{
+		Name:      name,
+		Type:      ProbeTypeBroker,
+		Component: name,
+		Interval:  util.TimeDuration(GetConfig().BrokersConfig.IntervalSeconds, 60, time.Second),
+		Timeout:   time.Duration(GetConfig().BrokersConfig.TimeoutSeconds) * time.Second,
+		run: func(ctx context.Context) {
+			if err := EvaluateBrokers(ctx, prefixURL, token); err != nil {
+				log.Errorf("pulsar brokers monitoring failed, error: %v", err)
 			}
-		}
-	}(prefixURL, token, interval)
-	return nil
+		},
+	})
+	return []*Probe{p}
 }
@@ -1,6 +1,8 @@
 package cfg
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -17,6 +19,9 @@ type ClusterHealth struct {
 	sync.RWMutex
 	Status         k8s.ClusterStatusCode
 	MissingBrokers int
+	// the offline instances of each component and the last evaluation time
+	Components k8s.ClusterStatus
+	UpdatedAt  time.Time
 }
 
 var clusterHealth = ClusterHealth{}
@@ -28,6 +33,21 @@ func (h *ClusterHealth) Get() (k8s.ClusterStatusCode, int) {
 	return h.Status, h.MissingBrokers
 }
 
+// GetComponents gets the health status of the cluster components and the last evaluation time
+func (h *ClusterHealth) GetComponents() (k8s.ClusterStatus, time.Time) {
+	h.RLock()
+	defer h.RUnlock()
+	return h.Components, h.UpdatedAt
+}
+
+// SetComponents sets the health status of the cluster components
+func (h *ClusterHealth) SetComponents(status k8s.ClusterStatus) {
+	h.Lock()
+	h.Components = status
+	h.UpdatedAt = time.Now()
+	h.Unlock()
+}
+
 // Set sets the cluster health status
 func (h *ClusterHealth) Set(status k8s.ClusterStatusCode, offlineBrokers int) {
 	h.Lock()
@@ -42,15 +62,20 @@ func EvaluateClusterHealth(client *k8s.Client) error {
 	cluster := GetConfig().Name + "-in-cluster"
 	ns := util.AssignString(k8sCfg.PulsarNamespace, k8s.DefaultPulsarNamespace)
 	// again this is for in-cluster monitoring only
+	registerProbeComponent(cluster, util.AssignString(GetConfig().ClusterName, GetConfig().Name), ProbeTypeK8s)
 
+	start := time.Now()
 	if err := client.UpdateReplicas(ns); err != nil {
+		recordProbeResult(cluster, ProbeTypeK8s, time.Since(start), err)
 		return err
 	}
 	if err := client.WatchPods(ns); err != nil {
+		recordProbeResult(cluster, ProbeTypeK8s, time.Since(start), err)
 		return err
 	}
 	desc, status := client.EvalHealth()
 	clusterHealth.Set(status.Status, status.BrokerOfflineInstances)
+	clusterHealth.SetComponents(status)
 
 	PromGaugeInt(GetOfflinePodsCounter(k8sZookeeperSubsystem), cluster, status.ZookeeperOfflineInstances)
 	PromGaugeInt(GetOfflinePodsCounter(k8sBookkeeperSubsystem), cluster, status.BookkeeperOfflineInstances)
@@ -59,11 +84,13 @@ func EvaluateClusterHealth(client *k8s.Client) error {
 
 	if status.Status != k8s.OK {
 		errMsg := fmt.Sprintf("cluster %s, k8s pulsar cluster status is unhealthy, error message %s", cluster, desc)
+		recordProbeResult(cluster, ProbeTypeK8s, time.Since(start), probeError(reasonUnhealthy, errors.New(errMsg)))
 		if status.Status == k8s.TotalDown {
 			VerboseAlert(cluster, errMsg, 3*time.Minute)
 			ReportIncident(cluster, cluster, "kubernete cluster is down, reported by pulsar-monitor", errMsg, &k8sCfg.AlertPolicy)
 		}
 	} else {
+		recordProbeResult(cluster, ProbeTypeK8s, time.Since(start), nil)
 		ClearIncident(cluster)
 	}
 	log.Infof("k8s cluster status %v", status)
@@ -72,30 +99,34 @@ func EvaluateClusterHealth(client *k8s.Client) error {
 
 // MonitorK8sPulsarCluster start K8sPulsarClusterMonitor thread
 func MonitorK8sPulsarCluster() error {
+	list, err := registerK8sProbes()
+	if err != nil {
+		return err
+	}
+	for _, p := range list {
+		log.Infof("start k8s cluster monitoring ...")
+		scheduleProbe(p, false)
+	}
+	return nil
+}
+
+func registerK8sProbes() ([]*Probe, error) {
 	k8sCfg := GetConfig().K8sConfig
 	if !k8sCfg.Enabled {
-		return nil
+		return nil, nil
 	}
 
 	ns := util.AssignString(k8sCfg.PulsarNamespace, k8s.DefaultPulsarNamespace)
 	clientset, err := k8s.GetK8sClient(ns)
 	if err != nil {
 		log.Errorf("failed to get k8s clientset %v or get pods under pulsar namespace", err)
-		return err
+		return nil, err
 	}
 
-	go func(client *k8s.Client) {
-		log.Infof("start k8s cluster monitoring ...")
-		ticker := time.NewTicker(clusterMonInterval)
-		for {
-			select {
-			case <-ticker.C:
-				if err := EvaluateClusterHealth(clientset); err != nil {
-					log.Errorf("k8s monitoring failed to watchpods error: %v", err)
-				}
-			}
+	p := RegisterProbe(GetConfig().Name+"-in-cluster", ProbeTypeK8s, clusterMonInterval, func(ctx context.Context) {
+		if err := EvaluateClusterHealth(clientset); err != nil {
+			log.Errorf("k8s monitoring failed to watchpods error: %v", err)
 		}
-
-	}(clientset)
-	return nil
+	})
+	return []*Probe{p}, nil
 }
@@ -3,12 +3,15 @@ package cfg
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
+	"github.com/kafkaesque-io/pulsar-monitor/src/stats"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 
 	"github.com/apex/log"
@@ -21,6 +24,24 @@ type PrometheusCfg struct {
 	ExposeMetrics         bool   `json:"exposeMetrics"`
 	PrometheusProxyURL    string `json:"prometheusProxyURL"`
 	PrometheusProxyAPIKey string `json:"prometheusProxyAPIKey"`
+	// Labels are static labels added to every metric, i.e. region or environment
+	Labels map[string]string `json:"labels"`
+	// LatencyBucketsMs are the upper bounds of the latency histogram buckets in milliseconds
+	LatencyBucketsMs []float64 `json:"latencyBucketsMs"`
+	// RemoteWrite pushes the metrics to a Prometheus remote write endpoint
+	RemoteWrite RemoteWriteCfg `json:"remoteWrite"`
+}
+
+// RemoteWriteCfg is the Prometheus remote write configuration
+type RemoteWriteCfg struct {
+	URL             string            `json:"url"`
+	Authorization   string            `json:"authorization"`   // the Authorization header, i.e. Bearer <token>
+	IntervalSeconds int               `json:"intervalSeconds"` // 15 seconds by default
+	TimeoutSeconds  int               `json:"timeoutSeconds"`  // 30 seconds per request by default
+	BatchSize       int               `json:"batchSize"`       // the maximum series per request, 500 by default
+	Retries         *int              `json:"retries"`         // 3 by default, 0 disables the retries
+	ExternalLabels  map[string]string `json:"externalLabels"`
+	MetricPrefixes  []string          `json:"metricPrefixes"` // the name prefixes of the metrics written, every metric by default
 }
 
 // SlackCfg is slack configuration
@@ -37,6 +58,21 @@ type OpsGenieCfg struct {
 	IntervalSeconds int    `json:"intervalSeconds"`
 }
 
+// PagerDutyCfg is PagerDuty Events API v2 configuration
+type PagerDutyCfg struct {
+	IntegrationKey string `json:"integrationKey"`
+	// EventsURL overrides the default Events API v2 endpoint
+	EventsURL string `json:"eventsUrl"`
+}
+
+// AdminAPICfg is the admin REST API configuration
+type AdminAPICfg struct {
+	// Token is required as a bearer token by the admin API endpoints that trigger probes or change silences,
+	// the endpoints are disabled without it. The read only endpoints require it if it is set and are public otherwise.
+	// The dashboard is not authenticated.
+	Token string `json:"token"`
+}
+
 // AnalyticsCfg is analytics usage and statistucs tracking configuration
 type AnalyticsCfg struct {
 	APIKey            string `json:"apiKey"`
@@ -51,11 +87,13 @@ type SiteCfg struct {
 	URL             string            `json:"url"`
 	Name            string            `json:"name"`
 	IntervalSeconds int               `json:"intervalSeconds"`
+	TimeoutSeconds  int               `json:"timeoutSeconds"` // hard timeout of a run, the interval by default
 	ResponseSeconds int               `json:"responseSeconds"`
 	StatusCode      int               `json:"statusCode"`
 	StatusCodeExpr  string            `json:"statusCodeExpr"`
 	Retries         int               `json:"retries"`
 	AlertPolicy     AlertPolicyCfg    `json:"alertPolicy"`
+	ProbeScheduleCfg
 }
 
 // SitesCfg configures a list of website`
@@ -75,11 +113,12 @@ type PulsarAdminRESTCfg struct {
 	Token           string          `json:"Token"`
 	Clusters        []OpsClusterCfg `json:"clusters"`
 	IntervalSeconds int             `json:"intervalSeconds"`
+	TimeoutSeconds  int             `json:"timeoutSeconds"` // hard timeout of a run, the interval by default
 }
 
 // TopicCfg is topic configuration
 type TopicCfg struct {
-	Name               string         `json:"name"`
+	Name               string         `json:"name"` // the cluster host name by default, required for several topics on a cluster
 	Token              string         `json:"token"`
 	TrustStore         string         `json:"trustStore"`
 	NumberOfPartitions int            `json:"numberOfPartitions"`
@@ -89,10 +128,17 @@ type TopicCfg struct {
 	TopicName          string         `json:"topicName"`
 	OutputTopic        string         `json:"outputTopic"`
 	IntervalSeconds    int            `json:"intervalSeconds"`
+	TimeoutSeconds     int            `json:"timeoutSeconds"` // hard timeout of a run, the interval by default
 	ExpectedMsg        string         `json:"expectedMsg"`
 	PayloadSizes       []string       `json:"payloadSizes"`
 	NumOfMessages      int            `json:"numberOfMessages"`
 	AlertPolicy        AlertPolicyCfg `json:"AlertPolicy"`
+	ProbeScheduleCfg
+	// LatencyBudgetPercentile is the message latency compared with the latency budget,
+	// one of mean, min, p50, p95, p99 and max, mean by default
+	LatencyBudgetPercentile string `json:"latencyBudgetPercentile"`
+	// AnomalyDetector evaluates the latency against the baseline of the previous runs
+	AnomalyDetector AnomalyDetectorCfg `json:"anomalyDetector"`
 }
 
 // WsConfig is configuration to monitor WebSocket pub sub latency
@@ -105,11 +151,15 @@ type WsConfig struct {
 	ConsumerURL     string         `json:"consumerUrl"`
 	TopicName       string         `json:"topicName"`
 	IntervalSeconds int            `json:"intervalSeconds"`
+	TimeoutSeconds  int            `json:"timeoutSeconds"` // hard timeout of a run, the interval by default
 	Scheme          string         `json:"scheme"`
 	Port            string         `json:"port"`
 	Subscription    string         `json:"subscription"`
 	URLQueryParams  string         `json:"urlQueryParams"`
 	AlertPolicy     AlertPolicyCfg `json:"AlertPolicy"`
+	ProbeScheduleCfg
+	// AnomalyDetector evaluates the latency against the baseline of the previous runs
+	AnomalyDetector AnomalyDetectorCfg `json:"anomalyDetector"`
 }
 
 // K8sClusterCfg is configuration to monitor kubernete cluster
@@ -125,6 +175,7 @@ type K8sClusterCfg struct {
 type BrokersCfg struct {
 	InClusterRESTURL string         `json:"inclusterRestURL"`
 	IntervalSeconds  int            `json:"intervalSeconds"`
+	TimeoutSeconds   int            `json:"timeoutSeconds"` // hard timeout of a run, the interval by default
 	AlertPolicy      AlertPolicyCfg `json:"AlertPolicy"`
 }
 
@@ -134,6 +185,89 @@ type TenantUsageCfg struct {
 	AlertIntervalMinutes int    `json:"alertIntervalMinutes"`
 }
 
+// MaintenanceWindowCfg is a recurring silence, a window starts at every scheduled minute
+type MaintenanceWindowCfg struct {
+	Name string `json:"name"`
+	// Schedule is a five field cron expression, i.e. "0 2 * * 6" is every Saturday at 2am
+	Schedule string `json:"schedule"`
+	// Timezone of the schedule, i.e. America/New_York, default is UTC
+	Timezone        string         `json:"timezone"`
+	DurationMinutes int            `json:"durationMinutes"`
+	Matchers        SilenceMatcher `json:"matchers"`
+}
+
+// ProbeScheduleCfg restricts when a probe runs, it is a part of the topic, websocket and site configurations
+type ProbeScheduleCfg struct {
+	// Schedule is a five field cron expression, the probe runs at every scheduled minute instead of the interval
+	Schedule string `json:"schedule"`
+	// ActiveHours are time of day ranges such as "09:00-17:00" or "22:00-06:00", the probe only runs within them
+	ActiveHours []string `json:"activeHours"`
+	// Timezone of the schedule and the active hours, i.e. America/New_York, default is UTC
+	Timezone string `json:"timezone"`
+}
+
+// OTLPCfg is the OpenTelemetry OTLP/HTTP exporter configuration
+type OTLPCfg struct {
+	// Endpoint is the base url of the collector, i.e. http://otel-collector:4318
+	Endpoint string `json:"endpoint"`
+	// Headers are added to the export requests, i.e. the authorization of the collector
+	Headers map[string]string `json:"headers"`
+	// ResourceAttributes are added to the service.name and service.instance.id resource attributes
+	ResourceAttributes map[string]string `json:"resourceAttributes"`
+	// IntervalSeconds is the export interval, 10 seconds by default
+	IntervalSeconds int `json:"intervalSeconds"`
+	// TimeoutSeconds is the timeout of an export request, 10 seconds by default
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+// LatencyWindowCfg configures the sliding window of the latency samples of a cluster
+// a latency over the standard deviations of the window is reported as an anomaly
+type LatencyWindowCfg struct {
+	// Size is the maximum number of the latest samples, 1440 by default
+	Size int `json:"size"`
+	// MinSamples is the number of samples required before the latency is evaluated, 10 by default
+	MinSamples int `json:"minSamples"`
+	// HalfLifeSeconds is the time for the weight of a sample to halve, the samples do not decay by default
+	HalfLifeSeconds int `json:"halfLifeSeconds"`
+}
+
+func (c LatencyWindowCfg) windowOptions() stats.WindowOptions {
+	return stats.WindowOptions{
+		Size:       c.Size,
+		MinSamples: c.MinSamples,
+		HalfLife:   time.Duration(c.HalfLifeSeconds) * time.Second,
+	}
+}
+
+// AnomalyDetectorCfg selects the detector of the latency anomalies of a probe
+type AnomalyDetectorCfg struct {
+	// Type is sigma, ewma, mad or seasonal, sigma by default
+	// seasonal compares the latency with the runs in the same hour of the week in the timezone of the probe
+	Type string `json:"type"`
+	// Threshold is the deviations over the baseline of an anomaly, 6 for sigma, 3 for ewma, 3.5 for mad and seasonal by default
+	Threshold float64 `json:"threshold"`
+	// Alpha is the smoothing factor of ewma between 0 and 1, 0.1 by default
+	Alpha float64 `json:"alpha"`
+	// WindowSize is the samples of sigma and mad, the latencyWindowConfig size by default,
+	// or the samples of every hour of the week of seasonal, 240 by default
+	WindowSize int `json:"windowSize"`
+	// MinSamples is the number of samples required before the latency is evaluated, 10 by default
+	MinSamples int `json:"minSamples"`
+}
+
+// SchedulerCfg spreads the probe runs to avoid synchronized bursts against a cluster
+type SchedulerCfg struct {
+	// StartupJitterSeconds delays the first run of every probe and periodic task by a random time up to it
+	StartupJitterSeconds int `json:"startupJitterSeconds"`
+	// JitterPercent delays every later run by a random time up to the percentage of the interval
+	JitterPercent int `json:"jitterPercent"`
+	// StaggerSeconds is the delay between the first runs of the probes started together, in the configured order
+	StaggerSeconds int `json:"staggerSeconds"`
+	// Spread spreads the first runs of the probes started together evenly across their interval
+	// It takes precedence over staggerSeconds.
+	Spread bool `json:"spread"`
+}
+
 // Configuration - this server's configuration
 type Configuration struct {
 	// Name is the Pulsar cluster name, it is mandatory
@@ -142,6 +276,8 @@ type Configuration struct {
 	ClusterName string `json:"clusterName"`
 	// TokenFilePath is the file path to Pulsar JWT. It takes precedence of the token attribute.
 	TokenFilePath string `json:"tokenFilePath"`
+	// StateFilePath is the file path to persist open incidents and alert policy counters across restarts, optional
+	StateFilePath string `json:"stateFilePath"`
 	// Token is a Pulsar JWT can be used for both client client or http admin client
 	Token             string             `json:"token"`
 	BrokersConfig     BrokersCfg         `json:"brokersConfig"`
@@ -151,11 +287,25 @@ type Configuration struct {
 	PrometheusConfig  PrometheusCfg      `json:"prometheusConfig"`
 	SlackConfig       SlackCfg           `json:"slackConfig"`
 	OpsGenieConfig    OpsGenieCfg        `json:"opsGenieConfig"`
+	PagerDutyConfig   PagerDutyCfg       `json:"pagerDutyConfig"`
+	AdminAPIConfig    AdminAPICfg        `json:"adminApiConfig"`
 	PulsarAdminConfig PulsarAdminRESTCfg `json:"pulsarAdminRestConfig"`
 	PulsarTopicConfig []TopicCfg         `json:"pulsarTopicConfig"`
 	SitesConfig       SitesCfg           `json:"sitesConfig"`
 	WebSocketConfig   []WsConfig         `json:"webSocketConfig"`
 	TenantUsageConfig TenantUsageCfg     `json:"tenantUsageConfig"`
+	SchedulerConfig   SchedulerCfg       `json:"schedulerConfig"`
+	// AlertSinks restricts the active incident and alert sinks by name, i.e. slack, opsgenie, pagerduty
+	// all configured sinks are active if it is not specified
+	AlertSinks []string `json:"alertSinks"`
+	// Silences suppress incidents and alerts of the matched components between the start and end time
+	Silences []Silence `json:"silences"`
+	// MaintenanceWindows are recurring silences
+	MaintenanceWindows []MaintenanceWindowCfg `json:"maintenanceWindows"`
+	// OTLPConfig exports the probe runs as traces and metrics to an OpenTelemetry collector
+	OTLPConfig OTLPCfg `json:"otlpConfig"`
+	// LatencyWindowConfig bounds the latency samples of the standard deviation evaluation
+	LatencyWindowConfig LatencyWindowCfg `json:"latencyWindowConfig"`
 }
 
 // AlertPolicyCfg is a set of criteria to evaluation triggers for incident alert
@@ -165,49 +315,79 @@ type AlertPolicyCfg struct {
 	// Second evaluation for moving window
 	MovingWindowSeconds   int `json:"movingWindowSeconds"`
 	CeilingInMovingWindow int `json:"ceilingInMovingWindow"`
+	// recovery criteria to resolve a firing incident, both have to be met if both are specified
+	// the incident is resolved by the first successful probe if none is specified
+	// number of consecutive successful probes
+	RecoveryCount int `json:"recoveryCount"`
+	// duration in seconds of continuous successful probes
+	RecoverySeconds int `json:"recoverySeconds"`
+	// flap detection, a component is flapping when its incident is opened and resolved
+	// flapThreshold times within the window. The flap detection is disabled if threshold is 0
+	FlapWindowSeconds int `json:"flapWindowSeconds"`
+	FlapThreshold     int `json:"flapThreshold"`
 }
 
-// Config - this server's configuration instance
-var Config Configuration
+var (
+	// config is this server's configuration instance, it is replaced as a whole on reload
+	config     = &Configuration{}
+	configLock = &sync.RWMutex{}
+)
 
-// ReadConfigFile reads configuration file.
-func ReadConfigFile(configFile string) {
+// ReadConfigFile reads, validates and applies the configuration file.
+func ReadConfigFile(configFile string) error {
+	c, err := LoadConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+	setConfig(c)
+	// the configuration is not logged since it has the tokens and the keys of the sinks
+	log.Infof("config %s of monitor %s is applied, %d topic, %d websocket and %d site tests",
+		configFile, c.Name, len(c.PulsarTopicConfig), len(c.WebSocketConfig), len(c.SitesConfig.Sites))
+	return nil
+}
 
+// LoadConfigFile reads and validates a configuration file without applying it.
+// A ConfigErrors is returned with every problem found along with the parsed configuration.
+func LoadConfigFile(configFile string) (*Configuration, error) {
 	fileBytes, err := ioutil.ReadFile(configFile)
 	if err != nil {
-		log.Errorf("failed to load configuration file %s", configFile)
-		panic(err)
+		return nil, fmt.Errorf("failed to load configuration file %s: %v", configFile, err)
 	}
 
+	c := Configuration{}
+	jsonBytes := fileBytes
 	if hasJSONPrefix(fileBytes) {
-		err = json.Unmarshal(fileBytes, &Config)
-		if err != nil {
-			panic(err)
+		if err = json.Unmarshal(fileBytes, &c); err != nil {
+			return nil, fmt.Errorf("failed to parse json configuration file %s: %v", configFile, err)
 		}
 	} else {
-		err = yaml.Unmarshal(fileBytes, &Config)
-		if err != nil {
-			panic(err)
+		if err = yaml.Unmarshal(fileBytes, &c); err != nil {
+			return nil, fmt.Errorf("failed to parse yaml configuration file %s: %v", configFile, err)
+		}
+		if jsonBytes, err = yaml.YAMLToJSON(fileBytes); err != nil {
+			return nil, fmt.Errorf("failed to parse yaml configuration file %s: %v", configFile, err)
 		}
 	}
 
-	if len(Config.Name) < 1 {
-		panic("a valid `name` in Configuration must be specified")
-	}
+	errs := checkUnknownFields(jsonBytes)
+	errs = append(errs, ValidateConfig(&c)...)
 
 	// reconcile the JWT
-	if len(Config.TokenFilePath) > 1 {
-		tokenBytes, err := ioutil.ReadFile(Config.TokenFilePath)
+	if len(c.TokenFilePath) > 1 {
+		tokenBytes, err := ioutil.ReadFile(c.TokenFilePath)
 		if err != nil {
-			log.Errorf("failed to read Pulsar JWT from a file %s", Config.TokenFilePath)
+			log.Errorf("failed to read Pulsar JWT from a file %s", c.TokenFilePath)
 		} else {
-			log.Infof("read Pulsar token from the file %s", Config.TokenFilePath)
-			Config.Token = string(tokenBytes)
+			log.Infof("read Pulsar token from the file %s", c.TokenFilePath)
+			c.Token = string(tokenBytes)
 		}
 	}
-	Config.Token = strings.TrimSuffix(util.AssignString(Config.Token, os.Getenv("PulsarToken")), "\n")
+	c.Token = strings.TrimSuffix(util.AssignString(c.Token, os.Getenv("PulsarToken")), "\n")
 
-	log.Infof("config %v", Config)
+	if len(errs) > 0 {
+		return &c, errs
+	}
+	return &c, nil
 }
 
 var jsonPrefix = []byte("{")
@@ -222,25 +402,23 @@ func hasPrefix(buf []byte, prefix []byte) bool {
 	return bytes.HasPrefix(trim, prefix)
 }
 
-//GetConfig returns a reference to the Configuration
+// GetConfig returns a reference to the current Configuration
+// The reference stays valid after a reload, it is not updated by the reload.
 func GetConfig() *Configuration {
-	return &Config
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config
+}
+
+func setConfig(c *Configuration) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	config = c
 }
 
-//
 type monitorFunc func()
 
-// RunInterval runs interval
+// RunInterval runs fn immediately and at every interval until the scheduler stops
 func RunInterval(fn monitorFunc, interval time.Duration) {
-	go func() {
-		ticker := time.NewTicker(interval)
-		fn()
-		for {
-			select {
-			case <-ticker.C:
-				fn()
-			}
-		}
-
-	}()
+	getScheduler().Every(interval, true, fn)
 }
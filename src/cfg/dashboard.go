@@ -0,0 +1,274 @@
+package cfg
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/k8s"
+)
+
+// a read only HTML status page of the probes, open incidents and the k8s cluster health
+
+const (
+	sparklineWidth  = 180
+	sparklineHeight = 28
+)
+
+type sparklinePoint struct {
+	X, Y float64
+}
+
+type dashboardProbe struct {
+	Name      string
+	Type      string
+	Component string
+	Interval  time.Duration
+	State     string
+	Status    ProbeStatus
+	Policy    IncidentState
+	Silenced  string
+	Incident  *IncidentStatus
+	Points    string
+	Failures  []sparklinePoint
+	MaxMs     float64
+}
+
+type dashboardComponent struct {
+	Name    string
+	Offline int
+}
+
+type dashboardK8s struct {
+	Status     string
+	Components []dashboardComponent
+	UpdatedAt  time.Time
+}
+
+type dashboardData struct {
+	Name        string
+	GeneratedAt time.Time
+	Probes      []dashboardProbe
+	Incidents   []IncidentStatus
+	Silences    []Silence
+	K8s         *dashboardK8s
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Truncate(time.Second).String() + " ago"
+	},
+	"ms": func(v float64) string {
+		return fmt.Sprintf("%.1f ms", v)
+	},
+}).Parse(dashboardHTML))
+
+// RegisterDashboard registers the HTML status page handler
+func RegisterDashboard(mux *http.ServeMux) {
+	mux.HandleFunc("/dashboard", dashboardHandler)
+}
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, buildDashboard(time.Now())); err != nil {
+		log.Errorf("failed to render dashboard %v", err)
+	}
+}
+
+func buildDashboard(now time.Time) dashboardData {
+	data := dashboardData{
+		Name:        GetConfig().Name,
+		GeneratedAt: now,
+		Incidents:   GetIncidents(),
+	}
+	for _, s := range GetSilences() {
+		if s.Active(now) {
+			data.Silences = append(data.Silences, s)
+		}
+	}
+
+	incidentMap := make(map[string]IncidentStatus)
+	for _, v := range data.Incidents {
+		incidentMap[v.Component] = v
+	}
+	policyMap := make(map[string]IncidentState)
+	for _, v := range GetPolicyStatuses() {
+		policyMap[v.Component] = v.State
+	}
+
+	for _, p := range GetProbes() {
+		probe := dashboardProbe{
+			Name:      p.Name,
+			Type:      p.Type,
+			Component: p.Component,
+			Interval:  p.Interval,
+			Status:    getProbeStatus(p.Type, p.Name),
+			Policy:    StateOK,
+			Silenced:  silenceReason(lookupLabels(p.Component), now),
+		}
+		if state, ok := policyMap[p.Component]; ok {
+			probe.Policy = state
+		}
+		if incident, ok := incidentMap[p.Component]; ok {
+			probe.Incident = &incident
+		}
+		switch {
+		case probe.Status.Runs == 0:
+			probe.State = "pending"
+		case probe.Status.Healthy:
+			probe.State = "healthy"
+		default:
+			probe.State = "failing"
+		}
+		probe.Points, probe.Failures, probe.MaxMs = sparkline(getProbeHistory(p.Type, p.Name))
+		data.Probes = append(data.Probes, probe)
+	}
+
+	if GetConfig().K8sConfig.Enabled {
+		status, updatedAt := clusterHealth.GetComponents()
+		data.K8s = &dashboardK8s{
+			Status: clusterStatusName(status.Status, updatedAt),
+			Components: []dashboardComponent{
+				{"zookeeper", status.ZookeeperOfflineInstances},
+				{"bookkeeper", status.BookkeeperOfflineInstances},
+				{"broker", status.BrokerOfflineInstances},
+				{"broker statefulset", status.BrokerStsOfflineInstances},
+				{"proxy", status.ProxyOfflineInstances},
+			},
+			UpdatedAt: updatedAt,
+		}
+	}
+	return data
+}
+
+func clusterStatusName(status k8s.ClusterStatusCode, updatedAt time.Time) string {
+	if updatedAt.IsZero() {
+		return "pending"
+	}
+	switch status {
+	case k8s.OK:
+		return "healthy"
+	case k8s.PartialReady:
+		return "degraded"
+	default:
+		return "down"
+	}
+}
+
+// sparkline returns the polyline points of the latency history, the points of failed samples and the max latency
+func sparkline(samples []ProbeSample) (string, []sparklinePoint, float64) {
+	if len(samples) == 0 {
+		return "", nil, 0
+	}
+	maxMs := 0.0
+	for _, s := range samples {
+		if s.Healthy && s.LatencyMs > maxMs {
+			maxMs = s.LatencyMs
+		}
+	}
+
+	step := 0.0
+	if len(samples) > 1 {
+		step = float64(sparklineWidth) / float64(len(samples)-1)
+	}
+	points := make([]string, 0, len(samples))
+	failures := []sparklinePoint{}
+	for i, s := range samples {
+		y := float64(sparklineHeight)
+		if maxMs > 0 {
+			// a failed sample usually has a timeout latency, it is drawn at the top
+			y = float64(sparklineHeight) * (1 - s.LatencyMs/maxMs)
+			if y < 0 || !s.Healthy {
+				y = 0
+			}
+		}
+		x := step * float64(i)
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		if !s.Healthy {
+			failures = append(failures, sparklinePoint{x, y})
+		}
+	}
+	return strings.Join(points, " "), failures, maxMs
+}
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>{{.Name}} pulsar monitor</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #ddd; vertical-align: middle; }
+th { background: #f4f4f4; }
+.healthy { color: #1a7f37; font-weight: bold; }
+.failing, .down { color: #cf222e; font-weight: bold; }
+.pending, .degraded { color: #9a6700; font-weight: bold; }
+.muted { color: #777; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{.Name}} pulsar monitor</h1>
+<p class="muted">generated at {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}, refreshed every 30 seconds</p>
+
+<h2>Probes</h2>
+<table>
+<tr><th>probe</th><th>type</th><th>state</th><th>last latency</th><th>history</th><th>last run</th><th>alert policy</th><th>open incident</th></tr>
+{{range .Probes}}
+<tr>
+<td>{{.Name}}{{if ne .Name .Component}}<div class="muted">{{.Component}}</div>{{end}}</td>
+<td>{{.Type}}</td>
+<td><span class="{{.State}}">{{.State}}</span>{{if .Status.Error}}<div class="muted">{{.Status.Error}}</div>{{end}}{{if .Silenced}}<div class="muted">silenced by {{.Silenced}}</div>{{end}}</td>
+<td>{{if .Status.Runs}}{{ms .Status.LatencyMs}}{{end}}</td>
+<td>{{if .Points}}<svg width="180" height="28" viewBox="-2 -2 184 32"><polyline fill="none" stroke="#0969da" stroke-width="1.5" points="{{.Points}}"/>{{range .Failures}}<circle cx="{{.X}}" cy="{{.Y}}" r="2.5" fill="#cf222e"/>{{end}}</svg><div class="muted">max {{ms .MaxMs}}, {{.Status.Failures}} of {{.Status.Runs}} runs failed</div>{{end}}</td>
+<td>{{ago .Status.LastRunAt}}<div class="muted">every {{.Interval}}</div></td>
+<td>{{.Policy}}</td>
+<td>{{with .Incident}}{{.Incident.Message}}<div class="muted">since {{ago .CreatedAt}}</div>{{else}}none{{end}}</td>
+</tr>
+{{else}}
+<tr><td colspan="8">no probe is configured</td></tr>
+{{end}}
+</table>
+
+{{with .K8s}}
+<h2>Kubernetes cluster</h2>
+<p>status <span class="{{.Status}}">{{.Status}}</span> <span class="muted">evaluated {{ago .UpdatedAt}}</span></p>
+<table>
+<tr><th>component</th><th>offline instances</th></tr>
+{{range .Components}}<tr><td>{{.Name}}</td><td>{{.Offline}}</td></tr>{{end}}
+</table>
+{{end}}
+
+<h2>Open incidents</h2>
+<table>
+<tr><th>component</th><th>priority</th><th>message</th><th>since</th></tr>
+{{range .Incidents}}
+<tr><td>{{.Component}}</td><td>{{.Incident.Priority}}</td><td>{{.Incident.Message}}<div class="muted">{{.Incident.Description}}</div></td><td>{{ago .CreatedAt}}</td></tr>
+{{else}}
+<tr><td colspan="4">no open incident</td></tr>
+{{end}}
+</table>
+
+{{if .Silences}}
+<h2>Active silences</h2>
+<table>
+<tr><th>id</th><th>component</th><th>cluster</th><th>probe</th><th>ends at</th><th>comment</th></tr>
+{{range .Silences}}
+<tr><td>{{.ID}}</td><td>{{.Matchers.Component}}</td><td>{{.Matchers.Cluster}}</td><td>{{.Matchers.Probe}}</td><td>{{.EndsAt.Format "2006-01-02 15:04 MST"}}</td><td>{{.Comment}}</td></tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,38 @@
+package cfg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	sink := &testSink{}
+	defer useTestSinks(sink)()
+
+	RegisterProbe("dashboard-probe", ProbeTypeWebSocket, time.Minute, func(ctx context.Context) {})
+	recordProbeResult("dashboard-probe", ProbeTypeWebSocket, 12*time.Millisecond, nil)
+	recordProbeResult("dashboard-probe", ProbeTypeWebSocket, 100*time.Second, errors.New("timed out <script>"))
+	CreateIncident("dashboard-probe", "dashboard-cluster", "websocket persisted latency test failure", "description", "P2")
+	defer RemoveIncident("dashboard-probe")
+
+	mux := http.NewServeMux()
+	RegisterDashboard(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	assert(t, http.StatusOK == rec.Code, "dashboard is served")
+	page := rec.Body.String()
+	assert(t, strings.Contains(page, "dashboard-probe"), "probe is listed")
+	assert(t, strings.Contains(page, `<span class="failing">failing</span>`), "probe state")
+	assert(t, strings.Contains(page, "websocket persisted latency test failure"), "open incident is shown")
+	assert(t, strings.Contains(page, "<polyline"), "history sparkline")
+	assert(t, !strings.Contains(page, "<script>"), "error message is escaped")
+
+	points, failures, maxMs := sparkline(getProbeHistory(ProbeTypeWebSocket, "dashboard-probe"))
+	assert(t, "0.0,0.0 180.0,0.0" == points, "sparkline points %s", points)
+	assert(t, 1 == len(failures) && 12 == maxMs, "failed sample is marked")
+}
@@ -1,16 +1,12 @@
 package cfg
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/apex/log"
-	"github.com/hashicorp/go-retryablehttp"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 )
 
@@ -18,8 +14,9 @@ import (
 // incident tracker and policy are NOT thread safe struct and map.
 
 type incidentRecord struct {
-	requestID string
-	alertID   string
+	incident Incident
+	// key is the sink name, value is the sink specific reference to the incident
+	refs      map[string]string
 	createdAt time.Time
 }
 
@@ -27,13 +24,13 @@ var (
 	// AllowedPriorities a list of allowed priorities
 	AllowedPriorities = []string{"P1", "P2", "P3", "P4", "P5"}
 
-	// key is incident identifier, value is OpsGenie requestId for delete purpose
+	// key is incident identifier, value is the incident and its sink references for delete purpose
 	incidents = make(map[string]incidentRecord)
 
 	// lock for incidents map
 	incidentsLock = &sync.RWMutex{}
 
-	// TODO: this map is not thread safe.
+	// protected by incidentsLock
 	// track the downtime, since downtime won't be calculated when producing message works
 	// it has different definition than incident
 	// this is only applicable when Pulsar Monitor is deployed within a Pulsar cluster
@@ -45,10 +42,6 @@ var (
 	incidentTrackersLock = &sync.RWMutex{}
 )
 
-const (
-	opsGenieAlertURL = "https://api.opsgenie.com/v2/alerts"
-)
-
 // Incident is the struct for incident reporting
 type Incident struct {
 	Message     string    `json:"message"`
@@ -60,60 +53,165 @@ type Incident struct {
 	Timestamp   time.Time `json:"timestamp"`
 }
 
-// OpsGenieAlertCreateResponse is the response struct returned by OpsGenie
-// https://docs.opsgenie.com/docs/alert-api#section-create-alert
-type OpsGenieAlertCreateResponse struct {
-	Result    string  `json:"result"`
-	Took      float64 `json:"took"`
-	RequestID string  `json:"requestId"`
-}
-
-// OpsGenieAlertGetResponse is the response struct returned by OpsGenie
-// https://docs.opsgenie.com/docs/alert-api#section-create-alert
-type OpsGenieAlertGetResponse struct {
-	Data      alertGetData `json:"data"`
-	Took      float64      `json:"took"`
-	RequestID string       `json:"requestId"`
-}
-
-// alertGetData is data part of OpsGenieAlertGetResponse
-// only creates the attributes that we are interested
-type alertGetData struct {
-	Success   bool   `json:"success"`
-	IsSuccess bool   `json:"isSuccess"`
-	Status    string `json:"status"`
-	AlertID   string `json:"alertId"`
-	Alias     string `json:"alias"`
-}
+// IncidentState is the alert state of a component
+// ok -> pending -> firing -> resolving -> ok
+// a failure in resolving state returns to firing without creating a new incident
+type IncidentState string
 
-// OpsGenieAlertCloseRequest is the POST request payload json
-type OpsGenieAlertCloseRequest struct {
-	User   string `json:"user"`
-	Source string `json:"source"`
-	Note   string `json:"note"`
-}
+const (
+	// StateOK is a healthy component, it has no tracker
+	StateOK IncidentState = "ok"
+	// StatePending has failures but the alert policy has not reached the threshold
+	StatePending IncidentState = "pending"
+	// StateFiring has an open incident
+	StateFiring IncidentState = "firing"
+	// StateResolving has an open incident and waits for the recovery criteria to be met
+	StateResolving IncidentState = "resolving"
+)
 
 // IncidentAlertPolicy tracks and reports incident when threshold is reached
 type IncidentAlertPolicy struct {
 	Entity            string
+	State             IncidentState
+	StateChangedAt    time.Time
 	Counters          int
 	EvalWindowSeconds time.Duration
 	Alerts            map[time.Time]bool
 	LimitInWindow     int
 	Limit             int
 	LastUpdatedAt     time.Time
+	// recovery criteria and the consecutive successes in resolving state
+	RecoveryCount    int
+	RecoveryDuration time.Duration
+	Successes        int
+	// flap detection, the time of incident open and resolve transitions within the flap window
+	FlapWindow    time.Duration
+	FlapThreshold int
+	Transitions   []time.Time
+	Flapping      bool
+}
+
+// flapChange is the flap detection outcome of an alert policy evaluation
+type flapChange int
+
+const (
+	flapUnchanged flapChange = iota
+	flapStarted
+	flapEnded
+)
+
+// policyVerdict is the result of an alert policy evaluation
+type policyVerdict struct {
+	// alert is true when an incident has to be opened on failure, or can be resolved on success
+	alert    bool
+	flapping bool
+	flap     flapChange
+	flapMsg  string
+}
+
+func (t *IncidentAlertPolicy) transition(state IncidentState) {
+	if t.State == state {
+		return
+	}
+	t.State = state
+	t.StateChangedAt = time.Now()
+}
+
+func (t *IncidentAlertPolicy) isOpen() bool {
+	return t.State == StateFiring || t.State == StateResolving
+}
+
+// recordTransition records an incident open or resolve transition, returns true if the component starts flapping
+func (t *IncidentAlertPolicy) recordTransition() bool {
+	if t.FlapThreshold <= 0 {
+		return false
+	}
+	now := time.Now()
+	transitions := []time.Time{}
+	for _, v := range t.Transitions {
+		if now.Sub(v) < t.FlapWindow {
+			transitions = append(transitions, v)
+		}
+	}
+	t.Transitions = append(transitions, now)
+
+	if !t.Flapping && len(t.Transitions) >= t.FlapThreshold {
+		t.Flapping = true
+		return true
+	}
+	return false
+}
+
+// stabilized returns true when a flapping component has no transition for a full flap window
+func (t *IncidentAlertPolicy) stabilized() bool {
+	if !t.Flapping {
+		return false
+	}
+	if last := len(t.Transitions) - 1; last >= 0 && time.Since(t.Transitions[last]) < t.FlapWindow {
+		return false
+	}
+	t.Flapping = false
+	t.Transitions = nil
+	return true
+}
+
+// removable returns true if the tracker has nothing left to track, the recent transitions are kept for flap detection
+func (t *IncidentAlertPolicy) removable() bool {
+	if t.State != StateOK || t.Flapping {
+		return false
+	}
+	last := len(t.Transitions) - 1
+	return t.FlapThreshold <= 0 || last < 0 || time.Since(t.Transitions[last]) >= t.FlapWindow
+}
+
+func (t *IncidentAlertPolicy) flappingMessage() string {
+	return fmt.Sprintf("%s is flapping, the incident was opened or resolved %d times in %v",
+		t.Entity, len(t.Transitions), t.FlapWindow)
+}
+
+// evaluate evaluates a probe result against the alert policy and flap detection
+func (t *IncidentAlertPolicy) evaluate(component, msg, desc string, failed bool) policyVerdict {
+	v := policyVerdict{}
+	if t.stabilized() {
+		v.flap = flapEnded
+	}
+
+	wasOpen := t.isOpen()
+	if failed {
+		v.alert = t.report(component, msg, desc)
+	} else {
+		v.alert = t.clear()
+	}
+	// only the transitions that would open or resolve an incident count towards flapping
+	if v.alert && wasOpen != failed && t.recordTransition() {
+		v.flap = flapStarted
+		v.flapMsg = t.flappingMessage()
+	}
+	v.flapping = t.Flapping
+	return v
 }
 
 // return if alert is triggered
 func (t *IncidentAlertPolicy) report(component, msg, desc string) bool {
 	t.LastUpdatedAt = time.Now()
 	t.Entity = component
+	switch t.State {
+	case StateResolving:
+		// the recovery is interrupted
+		t.Successes = 0
+		t.transition(StateFiring)
+	case StateFiring:
+	default:
+		t.transition(StatePending)
+	}
+
 	t.Counters = t.Counters + 1
 	t.Alerts[time.Now()] = true
 	if t.Limit > 0 && t.Counters >= t.Limit {
 		// TODO: to be discussed if resetting to 0 is too relaxed
 		t.Counters = 0
 		t.Alerts = make(map[time.Time]bool)
+		t.transition(StateFiring)
 		return true
 	}
 
@@ -130,14 +228,37 @@ func (t *IncidentAlertPolicy) report(component, msg, desc string) bool {
 	if t.LimitInWindow > 0 && windowCounts >= t.LimitInWindow {
 		t.Counters = 0
 		t.Alerts = make(map[time.Time]bool)
+		t.transition(StateFiring)
 		return true
 	}
 	return false
 }
 
-func (t *IncidentAlertPolicy) clear() int {
+// clear evaluates a successful probe and returns whether the open incident can be resolved
+// The tracker can be removed once it is back to the ok state.
+func (t *IncidentAlertPolicy) clear() bool {
+	t.LastUpdatedAt = time.Now()
+	if t.State == StateFiring || t.State == StateResolving {
+		if t.State == StateFiring {
+			t.Successes = 0
+			t.transition(StateResolving)
+		}
+		t.Successes++
+		if t.Successes < t.RecoveryCount || time.Since(t.StateChangedAt) < t.RecoveryDuration {
+			return false
+		}
+		t.Successes = 0
+	}
+
+	// failures in the moving window are still counted after the recovery
 	t.Counters--
-	return t.Counters
+	if t.Counters > 0 {
+		t.transition(StatePending)
+	} else {
+		t.Counters = 0
+		t.transition(StateOK)
+	}
+	return true
 }
 
 func newPolicy(component, msg, desc string, eval *AlertPolicyCfg) IncidentAlertPolicy {
@@ -146,28 +267,68 @@ func newPolicy(component, msg, desc string, eval *AlertPolicyCfg) IncidentAlertP
 	newTracker.Alerts = make(map[time.Time]bool)
 	newTracker.LimitInWindow = eval.CeilingInMovingWindow
 	newTracker.Limit = eval.Ceiling
+	newTracker.RecoveryCount = eval.RecoveryCount
+	newTracker.RecoveryDuration = time.Duration(eval.RecoverySeconds) * time.Second
+	newTracker.FlapThreshold = eval.FlapThreshold
+	newTracker.FlapWindow = util.TimeDuration(eval.FlapWindowSeconds, 1800, time.Second)
 	newTracker.LastUpdatedAt = time.Now()
+	newTracker.transition(StateOK)
 	return newTracker
 }
 
 func trackIncident(component, msg, desc string, eval *AlertPolicyCfg) bool {
+	return evaluateIncident(component, msg, desc, eval).alert
+}
+
+func evaluateIncident(component, msg, desc string, eval *AlertPolicyCfg) policyVerdict {
 	incidentTrackersLock.Lock()
 	defer incidentTrackersLock.Unlock()
 	if tracker, ok := incidentTrackers[component]; ok {
-		return tracker.report(component, msg, desc)
+		return tracker.evaluate(component, msg, desc, true)
 	}
 	t := newPolicy(component, msg, desc, eval)
-	rc := t.report(component, msg, desc)
+	v := t.evaluate(component, msg, desc, true)
 	incidentTrackers[component] = &t
-	return rc
+	return v
+}
+
+// reportFlapping logs and exposes the flapping state change of a component
+func reportFlapping(component string, flap flapChange) {
+	switch flap {
+	case flapStarted:
+		log.Warnf("%s is flapping, incident create and resolve are suppressed", component)
+		PromGauge(FlappingGaugeOpt(), component, 1)
+	case flapEnded:
+		log.Infof("%s is no longer flapping", component)
+		PromGauge(FlappingGaugeOpt(), component, 0)
+	}
 }
 
 // ReportIncident reports an incident.
 func ReportIncident(component, alias, msg, desc string, eval *AlertPolicyCfg) {
-	if eval.Ceiling > 0 && trackIncident(component, msg, desc, eval) {
-		CreateIncident(component, alias, msg, desc, "P2")
-		AnalyticsReportIncident(component, alias, msg, desc)
-		return
+	defer markStateDirty()
+	// the alert policy still tracks failures of a silenced component
+	silenced := IsSilenced(component)
+	if eval.Ceiling > 0 {
+		v := evaluateIncident(component, msg, desc, eval)
+		reportFlapping(component, v.flap)
+		switch {
+		case silenced && (v.alert || v.flap == flapStarted):
+			log.Infof("%s incident is silenced, %s", component, msg)
+			return
+		case v.flap == flapStarted:
+			// a single flapping incident stays open until the component is stable
+			CreateIncident(component, alias, v.flapMsg, desc, "P2")
+			AnalyticsReportIncident(component, alias, v.flapMsg, desc)
+			return
+		case v.alert && v.flapping:
+			log.Infof("%s incident is suppressed because the component is flapping", component)
+			return
+		case v.alert:
+			CreateIncident(component, alias, msg, desc, "P2")
+			AnalyticsReportIncident(component, alias, msg, desc)
+			return
+		}
 	}
 
 	count := 0
@@ -176,30 +337,56 @@ func ReportIncident(component, alias, msg, desc string, eval *AlertPolicyCfg) {
 	// only run when this is a single in-cluster monitoring
 	if GetConfig().K8sConfig.Enabled && len(incidentTrackers) > 2 {
 		for _, v := range incidentTrackers {
-			if time.Since(v.LastUpdatedAt) < time.Minute {
+			if v.State != StateOK && time.Since(v.LastUpdatedAt) < time.Minute {
 				count++
 			}
 		}
 	}
 	incidentTrackersLock.RUnlock()
 
-	if count > 2 {
+	if count > 2 && !silenced {
+		incidentTrackersLock.Lock()
+		if tracker, ok := incidentTrackers[component]; ok {
+			tracker.transition(StateFiring)
+		}
+		incidentTrackersLock.Unlock()
 		CreateIncident(component, alias, msg, desc, "P2")
 		AnalyticsReportIncident(component, alias, msg+" reported by multiple monitor target failures", desc)
 	}
 }
 
-// ClearIncident clears an incident
+// ClearIncident clears an incident once the recovery criteria of the alert policy are met
 func ClearIncident(component string) {
-	RemoveIncident(component)
-
+	// evaluate to keep the silence state and gauge up to date
+	IsSilenced(component)
+	v := policyVerdict{alert: true}
 	incidentTrackersLock.Lock()
-	defer incidentTrackersLock.Unlock()
-	if tracker, ok := incidentTrackers[component]; ok {
-		if tracker.clear() == 0 {
+	tracker, ok := incidentTrackers[component]
+	if ok {
+		v = tracker.evaluate(component, "", "", false)
+		if tracker.removable() {
 			delete(incidentTrackers, component)
 		}
 	}
+	incidentTrackersLock.Unlock()
+
+	reportFlapping(component, v.flap)
+	if v.flap == flapStarted {
+		// keep the open incident as the flapping incident instead of resolving it
+		incidentsLock.RLock()
+		record, isOpen := incidents[component]
+		incidentsLock.RUnlock()
+		if isOpen {
+			CreateIncident(component, record.incident.Alias, v.flapMsg, record.incident.Description, record.incident.Priority)
+		}
+	}
+
+	if v.alert && !v.flapping {
+		RemoveIncident(component)
+	}
+	if ok {
+		markStateDirty()
+	}
 }
 
 // NewIncident creates a Incident object
@@ -219,196 +406,183 @@ func NewIncident(component, alias, msg, desc, priority string) Incident {
 	}
 }
 
-// CreateIncident creates incident
-func CreateIncident(component, alias, msg, desc, priority string) {
-	genieKey := GetConfig().OpsGenieConfig.AlertKey
-	err := CreateOpsGenieAlert(NewIncident(component, alias, msg, desc, priority), genieKey)
-	if err != nil {
-		Alert(fmt.Sprintf("from %s Opsgenie report incident error %v", component, err))
+// incidentUpdateInterval is the minimum time between the updates of an open incident with a new description only
+var incidentUpdateInterval = time.Hour
+
+// notifyUpdate returns true if an open incident has changed enough to update the sinks
+// A new message, i.e. the flapping transition, or a new priority is notified at once,
+// a new description at most once per interval since the descriptions carry the latest measurements.
+func notifyUpdate(sent, incident Incident) bool {
+	if sent.Message != incident.Message || sent.Priority != incident.Priority {
+		return true
 	}
+	return sent.Description != incident.Description && incident.Timestamp.Sub(sent.Timestamp) >= incidentUpdateInterval
 }
 
-// RemoveIncident removes an existing incident
-func RemoveIncident(component string) {
+// CreateIncident creates incident on all active sinks, or updates the incident if it is already open and has changed
+func CreateIncident(component, alias, msg, desc, priority string) {
+	incident := NewIncident(component, alias, msg, desc, priority)
+
 	incidentsLock.RLock()
-	record, ok := incidents[component]
+	record, isOpen := incidents[component]
 	incidentsLock.RUnlock()
+	update := isOpen && notifyUpdate(record.incident, incident)
 
-	if ok {
-		incidentsLock.Lock()
-		delete(incidents, component)
-		incidentsLock.Unlock()
-
-		downtimeDuration := time.Since(record.createdAt)
-		seconds := int(downtimeDuration.Seconds())
-		AnalyticsClearIncident(component, seconds)
-		PromLatencySum(PubSubDowntimeGaugeOpt(), component, downtimeDuration)
+	refs := make(map[string]string)
+	for k, v := range record.refs {
+		refs[k] = v
+	}
 
-		if record.alertID == "" {
-			log.Errorf("%s unable to identify alert with request id %s for auto clear operation", component, record.requestID)
-			return
+	for _, sink := range getIncidentSinks() {
+		if ref, ok := refs[sink.Name()]; ok {
+			if !update {
+				continue
+			}
+			if err := sink.UpdateIncident(incident, ref); err != nil {
+				Alert(fmt.Sprintf("from %s %s update incident error %v", component, sink.Name(), err))
+			}
+			continue
 		}
-		log.Infof("auto record alertID %v", record)
-		genieKey := GetConfig().OpsGenieConfig.AlertKey
-		err := CloseOpsGenieAlert(component, record.alertID, genieKey)
+		ref, err := sink.CreateIncident(incident)
 		if err != nil {
-			Alert(fmt.Sprintf("from %s Opsgenie remove incident error %v", component, err))
+			Alert(fmt.Sprintf("from %s %s report incident error %v", component, sink.Name(), err))
+			continue
 		}
+		refs[sink.Name()] = ref
 	}
-}
 
-// CalculateDowntime calculate downtime
-func CalculateDowntime(component string) {
-	if record, ok := downtimeTracker[component]; ok {
-		delete(downtimeTracker, component)
-		seconds := int(time.Since(record.createdAt).Seconds())
-		AnalyticsDowntime(component, seconds)
-	}
-}
-
-func opsGenieHTTP(method, endpoint, genieKey string, payload *bytes.Buffer) (*http.Response, error) {
-	if genieKey == "" {
-		errStr := fmt.Sprintf("Alert creation failed. %s has not configured with genieKey.", GetConfig().Name)
-		Alert(errStr)
-		return nil, fmt.Errorf(errStr)
+	incidentsLock.Lock()
+	if !isOpen {
+		record.createdAt = time.Now()
+		downtimeTracker[component] = incidentRecord{createdAt: record.createdAt}
 	}
-
-	client := retryablehttp.NewClient()
-	client.HTTPClient.Timeout = time.Duration(5) * time.Second
-	client.RetryWaitMin = 4 * time.Second
-	client.RetryWaitMax = 64 * time.Second
-	client.RetryMax = 2
-
-	log.Infof("method %v request URL %v", method, opsGenieAlertURL+endpoint)
-	req, err := retryablehttp.NewRequest(method, opsGenieAlertURL+endpoint, payload)
-	if err != nil {
-		return nil, err
+	// the record keeps the incident last sent to the sinks
+	if !isOpen || update {
+		record.incident = incident
 	}
+	record.refs = refs
+	incidents[component] = record
+	incidentsLock.Unlock()
 
-	req.Header.Set("Authorization", genieKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	return client.Do(req)
+	saveState()
 }
 
-// CreateOpsGenieAlert creates an OpsGenie alert
-func CreateOpsGenieAlert(msg Incident, genieKey string) error {
-	Alert(fmt.Sprintf("report incident as pager escalation %v", msg))
-
-	buf, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
-	resp, err := opsGenieHTTP(http.MethodPost, "", genieKey, bytes.NewBuffer(buf))
-	if resp != nil {
-		defer resp.Body.Close()
-	}
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode > 300 {
-		return fmt.Errorf("Create Opsgenie alert returns incorrect status code %d", resp.StatusCode)
-	}
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	alertResp := OpsGenieAlertCreateResponse{}
-	err = json.Unmarshal(bodyBytes, &alertResp)
-	if err != nil {
-		return err
-	}
+// RemoveIncident removes an existing incident and resolves it on all sinks
+func RemoveIncident(component string) {
+	incidentsLock.Lock()
+	record, ok := incidents[component]
+	delete(incidents, component)
+	incidentsLock.Unlock()
 
-	incident := incidentRecord{
-		requestID: alertResp.RequestID,
-		createdAt: time.Now(),
+	if !ok {
+		return
 	}
+	defer saveState()
 
-	incidentsLock.Lock()
-	defer incidentsLock.Unlock()
-	incidents[msg.Entity] = incident
-	downtimeTracker[msg.Entity] = incident
-
-	// there is a delay when the alert is created by opsgenie, so we use retry
-	// time out has to be less than the latency time interval
-	go getOpsGenieAlertIDRetry(msg.Entity, incident.requestID, genieKey, 4*time.Second)
-	return nil
-}
+	downtimeDuration := time.Since(record.createdAt)
+	seconds := int(downtimeDuration.Seconds())
+	AnalyticsClearIncident(component, seconds)
+	PromLatencySum(PubSubDowntimeGaugeOpt(), component, downtimeDuration)
 
-func getOpsGenieAlertIDRetry(entity, requestID, genieKey string, timeout time.Duration) {
-	start := time.Now()
-	for time.Since(start) < timeout {
-		time.Sleep(200 * time.Millisecond) //TODO: could have exponatial back off retry
-		alertID, err := getOpsGenieAlertID(requestID, genieKey)
-		if err == nil {
-			incidentsLock.Lock()
-			incident, ok := incidents[entity]
-			if ok {
-				incident.alertID = alertID
-				incidents[entity] = incident
-			}
-			log.Infof("found...")
-			incidentsLock.Unlock()
-			return
+	for _, sink := range getIncidentSinks() {
+		ref, ok := record.refs[sink.Name()]
+		if !ok {
+			continue
+		}
+		if err := sink.ResolveIncident(record.incident, ref); err != nil {
+			Alert(fmt.Sprintf("from %s %s remove incident error %v", component, sink.Name(), err))
 		}
 	}
-	log.Errorf("%s unable to find alert with requestId %s", entity, requestID)
 }
 
-// getOpsGenieAlertID gets alertID from a created alert.
-// alertID is used for alert clear purpose
-func getOpsGenieAlertID(requestID, genieKey string) (alertID string, err error) {
-	resp, err := opsGenieHTTP(http.MethodGet, "/requests/"+requestID, genieKey, &bytes.Buffer{})
-	if resp != nil {
-		defer resp.Body.Close()
-	}
-	if err != nil {
-		return "", err
-	}
+// CalculateDowntime calculate downtime
+func CalculateDowntime(component string) {
+	incidentsLock.Lock()
+	record, ok := downtimeTracker[component]
+	delete(downtimeTracker, component)
+	incidentsLock.Unlock()
 
-	if resp.StatusCode > 300 {
-		return "", fmt.Errorf("Get Opsgenie alert returns incorrect status code %d", resp.StatusCode)
+	if ok {
+		seconds := int(time.Since(record.createdAt).Seconds())
+		AnalyticsDowntime(component, seconds)
+		saveState()
 	}
+}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
+// IncidentStatus is an open incident and its sink references
+type IncidentStatus struct {
+	Component string            `json:"component"`
+	Incident  Incident          `json:"incident"`
+	Refs      map[string]string `json:"refs"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
 
-	alertResp := OpsGenieAlertGetResponse{}
-	err = json.Unmarshal(bodyBytes, &alertResp)
-	if err != nil {
-		return "", err
+// GetIncidents returns the open incidents sorted by the creation time
+func GetIncidents() []IncidentStatus {
+	incidentsLock.RLock()
+	list := make([]IncidentStatus, 0, len(incidents))
+	for k, v := range incidents {
+		refs := make(map[string]string)
+		for name, ref := range v.refs {
+			refs[name] = ref
+		}
+		list = append(list, IncidentStatus{
+			Component: k,
+			Incident:  v.incident,
+			Refs:      refs,
+			CreatedAt: v.createdAt,
+		})
 	}
+	incidentsLock.RUnlock()
 
-	return alertResp.Data.AlertID, nil
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
 }
 
-// CloseOpsGenieAlert deletes an OpsGenie alert
-func CloseOpsGenieAlert(component, alertID string, genieKey string) error {
-	buf, err := json.Marshal(OpsGenieAlertCloseRequest{
-		User:   "pulsar monitor",
-		Source: component,
-		Note:   "*automatically resolved the alert* (alertId) " + alertID,
-	})
-	if err != nil {
-		return err
-	}
+// PolicyStatus is the alert policy evaluation state of a component
+type PolicyStatus struct {
+	Component      string        `json:"component"`
+	State          IncidentState `json:"state"`
+	StateChangedAt time.Time     `json:"stateChangedAt"`
+	Counters       int           `json:"counters"`
+	Limit          int           `json:"limit"`
+	WindowCounts   int           `json:"windowCounts"`
+	LimitInWindow  int           `json:"limitInWindow"`
+	WindowSeconds  float64       `json:"windowSeconds"`
+	Successes      int           `json:"successes"`
+	RecoveryCount  int           `json:"recoveryCount"`
+	Flapping       bool          `json:"flapping"`
+	LastUpdatedAt  time.Time     `json:"lastUpdatedAt"`
+}
 
-	resp, err := opsGenieHTTP(http.MethodPost, fmt.Sprintf("/%s/close?identifierType=id", alertID), genieKey, bytes.NewBuffer(buf))
-	if resp != nil {
-		defer resp.Body.Close()
-	}
-	if err != nil {
-		return err
+// GetPolicyStatuses returns the alert policy state of the tracked components sorted by the component name
+func GetPolicyStatuses() []PolicyStatus {
+	incidentTrackersLock.RLock()
+	list := make([]PolicyStatus, 0, len(incidentTrackers))
+	for k, v := range incidentTrackers {
+		windowCounts := 0
+		for alertTime := range v.Alerts {
+			if time.Since(alertTime) < v.EvalWindowSeconds {
+				windowCounts++
+			}
+		}
+		list = append(list, PolicyStatus{
+			Component:      k,
+			State:          v.State,
+			StateChangedAt: v.StateChangedAt,
+			Counters:       v.Counters,
+			Limit:          v.Limit,
+			WindowCounts:   windowCounts,
+			LimitInWindow:  v.LimitInWindow,
+			WindowSeconds:  v.EvalWindowSeconds.Seconds(),
+			Successes:      v.Successes,
+			RecoveryCount:  v.RecoveryCount,
+			Flapping:       v.Flapping,
+			LastUpdatedAt:  v.LastUpdatedAt,
+		})
 	}
+	incidentTrackersLock.RUnlock()
 
-	if resp.StatusCode > 300 {
-		return fmt.Errorf("Close Opsgenie alert returns incorrect status code %d", resp.StatusCode)
-	}
-	return nil
+	sort.Slice(list, func(i, j int) bool { return list[i].Component < list[j].Component })
+	return list
 }
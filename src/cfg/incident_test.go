@@ -13,6 +13,8 @@ import (
 )
 
 func TestUnmarshConfigFile(t *testing.T) {
+	saved := GetConfig()
+	defer setConfig(saved)
 	ReadConfigFile("../../config/runtime-template.json")
 	assert(t, ":8083" == GetConfig().PrometheusConfig.Port, "load json config")
 	ReadConfigFile("../../config/runtime-template.yml")
@@ -168,6 +170,144 @@ func TestIncidentAlertMovingWindowPolicy(t *testing.T) {
 	assert(t, !trackIncident("component3", "time out message", "save me description", &policy), "")
 }
 
+type testSink struct {
+	created  []string
+	updated  []string
+	resolved []string
+}
+
+func (s *testSink) Name() string { return "test" }
+
+func (s *testSink) CreateIncident(incident Incident) (string, error) {
+	s.created = append(s.created, incident.Entity)
+	return "ref-" + incident.Entity, nil
+}
+
+func (s *testSink) UpdateIncident(incident Incident, ref string) error {
+	s.updated = append(s.updated, ref)
+	return nil
+}
+
+func (s *testSink) ResolveIncident(incident Incident, ref string) error {
+	s.resolved = append(s.resolved, ref)
+	return nil
+}
+
+func TestIncidentRecoveryPolicy(t *testing.T) {
+	sink := &testSink{}
+	defer useTestSinks(sink)()
+
+	policy := AlertPolicyCfg{
+		Ceiling:       2,
+		RecoveryCount: 3,
+	}
+	component := "recovery-component"
+	ReportIncident(component, component, "failure", "description", &policy)
+	assert(t, StatePending == incidentTrackers[component].State, "pending before reaching the ceiling")
+	ReportIncident(component, component, "failure", "description", &policy)
+	assert(t, StateFiring == incidentTrackers[component].State, "firing after reaching the ceiling")
+	assert(t, 1 == len(sink.created), "incident is created")
+
+	ClearIncident(component)
+	ClearIncident(component)
+	assert(t, StateResolving == incidentTrackers[component].State, "resolving until the recovery count is reached")
+	assert(t, 0 == len(sink.resolved), "incident is not resolved by a few successes")
+
+	// a failure interrupts the recovery without a new incident
+	ReportIncident(component, component, "failure", "description", &policy)
+	assert(t, StateFiring == incidentTrackers[component].State, "back to firing")
+	assert(t, 1 == len(sink.created), "no new incident while firing")
+
+	for i := 0; i < 2; i++ {
+		ClearIncident(component)
+	}
+	assert(t, 0 == len(sink.resolved), "consecutive successes restart after a failure")
+	ClearIncident(component)
+	assert(t, 1 == len(sink.resolved), "incident is resolved after consecutive successes")
+	_, ok := incidentTrackers[component]
+	assert(t, !ok, "tracker is removed in ok state")
+
+	policy = AlertPolicyCfg{
+		Ceiling:         1,
+		RecoverySeconds: 1,
+	}
+	ReportIncident(component, component, "failure", "description", &policy)
+	ClearIncident(component)
+	assert(t, 1 == len(sink.resolved), "incident is not resolved before the recovery duration")
+	time.Sleep(1 * time.Second)
+	ClearIncident(component)
+	assert(t, 2 == len(sink.resolved), "incident is resolved after the recovery duration")
+}
+
+func TestIncidentFlapDetection(t *testing.T) {
+	sink := &testSink{}
+	defer useTestSinks(sink)()
+
+	policy := AlertPolicyCfg{
+		Ceiling:           1,
+		FlapThreshold:     4,
+		FlapWindowSeconds: 1,
+	}
+	component := "flapping-component"
+	ReportIncident(component, component, "failure", "description", &policy)
+	ClearIncident(component)
+	ReportIncident(component, component, "failure", "description", &policy)
+	assert(t, 2 == len(sink.created) && 1 == len(sink.resolved), "incidents are created and resolved before flapping")
+
+	ClearIncident(component)
+	assert(t, incidentTrackers[component].Flapping, "component is flapping after reaching the threshold")
+	assert(t, 1 == len(sink.resolved), "flapping incident is not resolved")
+	assert(t, 1 == len(sink.updated), "open incident is updated as a flapping incident")
+
+	ReportIncident(component, component, "failure", "description", &policy)
+	ClearIncident(component)
+	assert(t, 2 == len(sink.created) && 1 == len(sink.resolved), "create and resolve are suppressed while flapping")
+
+	time.Sleep(1 * time.Second)
+	ClearIncident(component)
+	assert(t, 2 == len(sink.resolved), "flapping incident is resolved once the component is stable")
+	_, ok := incidentTrackers[component]
+	assert(t, !ok, "tracker is removed after flapping ends")
+}
+
+// useTestSinks replaces the active sinks and returns a function to restore them
+func useTestSinks(sinks ...IncidentSink) func() {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	previous := incidentSinks
+	incidentSinks = sinks
+	return func() {
+		sinksLock.Lock()
+		defer sinksLock.Unlock()
+		incidentSinks = previous
+	}
+}
+
+func TestIncidentSink(t *testing.T) {
+	sink := &testSink{}
+	defer useTestSinks(sink)()
+
+	CreateIncident("sink-component", "sink-alias", "message", "description", "P3")
+	assert(t, 1 == len(sink.created), "incident created on the sink")
+	CreateIncident("sink-component", "sink-alias", "message", "description", "P3")
+	assert(t, 1 == len(sink.created), "open incident is not created twice")
+	assert(t, 0 == len(sink.updated), "unchanged open incident is not updated")
+	CreateIncident("sink-component", "sink-alias", "flapping message", "description", "P3")
+	assert(t, 1 == len(sink.updated) && "ref-sink-component" == sink.updated[0], "open incident is updated with the sink reference")
+	CreateIncident("sink-component", "sink-alias", "flapping message", "new description", "P3")
+	assert(t, 1 == len(sink.updated), "a new description is not updated within the interval")
+	saved := incidentUpdateInterval
+	incidentUpdateInterval = 0
+	defer func() { incidentUpdateInterval = saved }()
+	CreateIncident("sink-component", "sink-alias", "flapping message", "new description", "P3")
+	assert(t, 2 == len(sink.updated), "a new description is updated after the interval")
+
+	RemoveIncident("sink-component")
+	assert(t, 1 == len(sink.resolved) && "ref-sink-component" == sink.resolved[0], "incident resolved with the sink reference")
+	RemoveIncident("sink-component")
+	assert(t, 1 == len(sink.resolved), "resolved incident is not resolved twice")
+}
+
 // assert fails the test if the condition is false.
 func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
 	if !condition {
@@ -1,27 +1,84 @@
 package cfg
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/kafkaesque-io/pulsar-monitor/src/metering"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
-	metrics   = make(map[string]*prometheus.GaugeVec)
-	summaries = make(map[string]*prometheus.SummaryVec)
-	counters  = make(map[string]*prometheus.CounterVec)
+	metrics    = make(map[string]*prometheus.GaugeVec)
+	histograms = make(map[string]*prometheus.HistogramVec)
+	counters   = make(map[string]*prometheus.CounterVec)
+	// guards metrics, histograms and counters
+	metricsLock = &sync.Mutex{}
 )
 
+// the default latency histogram buckets in milliseconds
+var defaultLatencyBucketsMs = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// the label names of the probe metrics, device is the cluster or the component as the other metrics
+var probeLabelNames = []string{"device", "probe", "type", "topic", "size_class"}
+
+// ProbeLabels identifies the series of a synthetic test in the probe metrics
+type ProbeLabels struct {
+	// Device is the cluster or the component
+	Device string
+	Probe  string
+	Type   string
+	// Topic is the topic under test, empty for the probes without a topic
+	Topic string
+	// SizeClass is the payload size class of the test messages, empty for the probes without payload
+	SizeClass string
+}
+
+func (l ProbeLabels) values() []string {
+	return []string{l.Device, l.Probe, l.Type, l.Topic, l.SizeClass}
+}
+
+// payload size classes by the largest payload size in bytes
+var payloadSizeClasses = []struct {
+	name     string
+	maxBytes int
+}{
+	{"small", 1024},
+	{"medium", 64 * 1024},
+	{"large", 1024 * 1024},
+}
+
+// payloadSizeClass classifies the payload sizes of a test by the largest one
+func payloadSizeClass(payloadSizes []string) string {
+	largest := 0
+	for _, size := range payloadSizes {
+		largest = util.MaxInt(largest, NumOfBytes(size))
+	}
+	for _, c := range payloadSizeClasses {
+		if largest <= c.maxBytes {
+			return c.name
+		}
+	}
+	return "xlarge"
+}
+
+// constLabels are the static labels from the configuration added to every metric
+// They are read when a metric is registered, a change of the labels requires a restart.
+func constLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	for k, v := range GetConfig().PrometheusConfig.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
 const (
 	funcTopicSubsystem     = "func_topic"
 	pubSubSubsystem        = "pubsub"
@@ -80,6 +137,26 @@ func MsgLatencyGaugeOpt(typeName, desc string) prometheus.GaugeOpts {
 	}
 }
 
+// StageLatencyGaugeOpt is the description for the pubsub latency of every stage
+func StageLatencyGaugeOpt() prometheus.GaugeOpts {
+	return prometheus.GaugeOpts{
+		Namespace: "pulsar",
+		Subsystem: pubSubSubsystem,
+		Name:      "stage_latency_ms",
+		Help:      "Pulsar pubsub latency in ms of the connect, producer create, subscribe, publish ack and end to end stages",
+	}
+}
+
+// LatencyPercentileGaugeOpt is the description for the percentiles of the message latencies in a pubsub test
+func LatencyPercentileGaugeOpt() prometheus.GaugeOpts {
+	return prometheus.GaugeOpts{
+		Namespace: "pulsar",
+		Subsystem: pubSubSubsystem,
+		Name:      "message_latency_ms",
+		Help:      "Pulsar pubsub min, p50, p95, p99 and max message latency in ms of a test",
+	}
+}
+
 // HeartbeatCounterOpt is the description for heart beat counter
 func HeartbeatCounterOpt() prometheus.CounterOpts {
 	return prometheus.CounterOpts{
@@ -90,6 +167,56 @@ func HeartbeatCounterOpt() prometheus.CounterOpts {
 	}
 }
 
+// ProbeSkippedCounterOpt is the description for the probe runs skipped since the previous run is in progress
+func ProbeSkippedCounterOpt() prometheus.CounterOpts {
+	return prometheus.CounterOpts{
+		Namespace: "pulsar",
+		Subsystem: "monitor",
+		Name:      "probe_skipped_total",
+		Help:      "Probe runs skipped since the previous run is still in progress",
+	}
+}
+
+// ProbeTimeoutCounterOpt is the description for the probe runs exceeding the timeout
+func ProbeTimeoutCounterOpt() prometheus.CounterOpts {
+	return prometheus.CounterOpts{
+		Namespace: "pulsar",
+		Subsystem: "monitor",
+		Name:      "probe_timeouts_total",
+		Help:      "Probe runs that exceeded the timeout",
+	}
+}
+
+// ProbeRunsCounterOpt is the description for the completed probe runs
+func ProbeRunsCounterOpt() prometheus.CounterOpts {
+	return prometheus.CounterOpts{
+		Namespace: "pulsar",
+		Subsystem: "monitor",
+		Name:      "probe_runs_total",
+		Help:      "Completed probe runs",
+	}
+}
+
+// ProbeSuccessesCounterOpt is the description for the successful probe runs
+func ProbeSuccessesCounterOpt() prometheus.CounterOpts {
+	return prometheus.CounterOpts{
+		Namespace: "pulsar",
+		Subsystem: "monitor",
+		Name:      "probe_successes_total",
+		Help:      "Successful probe runs",
+	}
+}
+
+// ProbeFailuresCounterOpt is the description for the failed probe runs by the reason
+func ProbeFailuresCounterOpt() prometheus.CounterOpts {
+	return prometheus.CounterOpts{
+		Namespace: "pulsar",
+		Subsystem: "monitor",
+		Name:      "probe_failures_total",
+		Help:      "Failed probe runs by the normalized failure reason",
+	}
+}
+
 // PubSubDowntimeGaugeOpt is the description for downtime summary
 func PubSubDowntimeGaugeOpt() prometheus.GaugeOpts {
 	return prometheus.GaugeOpts{
@@ -110,6 +237,26 @@ func FuncLatencyGaugeOpt() prometheus.GaugeOpts {
 	}
 }
 
+// SilencedGaugeOpt is the description of the silence state gauge, 1 is silenced
+func SilencedGaugeOpt() prometheus.GaugeOpts {
+	return prometheus.GaugeOpts{
+		Namespace: "pulsar",
+		Subsystem: "monitor",
+		Name:      "silenced",
+		Help:      "Pulsar monitor component silence state by silences or maintenance windows, 1 is silenced",
+	}
+}
+
+// FlappingGaugeOpt is the description of the flapping state gauge, 1 is flapping and 0 is stable
+func FlappingGaugeOpt() prometheus.GaugeOpts {
+	return prometheus.GaugeOpts{
+		Namespace: "pulsar",
+		Subsystem: "monitor",
+		Name:      "flapping",
+		Help:      "Pulsar monitor component flapping state, 1 is flapping",
+	}
+}
+
 // PromGaugeInt registers gauge reading in integer
 func PromGaugeInt(opt prometheus.GaugeOpts, cluster string, num int) {
 	PromGauge(opt, cluster, float64(num))
@@ -117,61 +264,135 @@ func PromGaugeInt(opt prometheus.GaugeOpts, cluster string, num int) {
 
 // PromGauge registers gauge reading
 func PromGauge(opt prometheus.GaugeOpts, cluster string, num float64) {
-	key := getMetricKey(opt)
-	if promMetric, ok := metrics[key]; ok {
-		promMetric.WithLabelValues(cluster).Set(num)
-	} else {
-		newMetric := prometheus.NewGaugeVec(opt, []string{"device"})
-		prometheus.Register(newMetric)
-		newMetric.WithLabelValues(cluster).Set(num)
-		metrics[key] = newMetric
-	}
+	gaugeVec(opt, []string{"device"}).WithLabelValues(cluster).Set(num)
 }
 
 // PromCounter registers counter and increment
 func PromCounter(opt prometheus.CounterOpts, cluster string) {
-	key := fmt.Sprintf("%s-%s-%s", opt.Namespace, opt.Subsystem, opt.Name)
-	if promMetric, ok := counters[key]; ok {
-		promMetric.WithLabelValues(cluster).Inc()
-	} else {
-		newMetric := prometheus.NewCounterVec(opt, []string{"device"})
-		prometheus.Register(newMetric)
-		newMetric.WithLabelValues(cluster).Inc()
-		counters[key] = newMetric
+	counterVec(opt, []string{"device"}).WithLabelValues(cluster).Inc()
+}
+
+// PromProbeCounter registers a probe counter and increment
+func PromProbeCounter(opt prometheus.CounterOpts, labels ProbeLabels) {
+	counterVec(opt, probeLabelNames).WithLabelValues(labels.values()...).Inc()
+}
+
+// PromProbeOutcome counts a probe run and its success or failure reason
+func PromProbeOutcome(name, probeType string, err error) {
+	counterVec(ProbeRunsCounterOpt(), []string{"probe", "type"}).WithLabelValues(name, probeType).Inc()
+	if err == nil {
+		counterVec(ProbeSuccessesCounterOpt(), []string{"probe", "type"}).WithLabelValues(name, probeType).Inc()
+		return
 	}
+	counterVec(ProbeFailuresCounterOpt(), []string{"probe", "type", "reason"}).
+		WithLabelValues(name, probeType, probeErrorReason(err)).Inc()
 }
 
 // PromLatencySum expose monitoring metrics to Prometheus
+// The latency is the gauge and an observation of the histogram with the _hst suffix.
 func PromLatencySum(opt prometheus.GaugeOpts, cluster string, latency time.Duration) {
+	promLatency(opt, []string{"device"}, []string{cluster}, latency, "")
+}
+
+// PromProbeLatency exposes the latency of a probe run to Prometheus
+// The observation carries the run id of the context as an exemplar.
+func PromProbeLatency(ctx context.Context, opt prometheus.GaugeOpts, labels ProbeLabels, latency time.Duration) {
+	promLatency(opt, probeLabelNames, labels.values(), latency, probeRunID(ctx))
+}
+
+// PromStageLatency exposes the latency of the measured stages of a pubsub probe run to Prometheus
+func PromStageLatency(ctx context.Context, labels ProbeLabels, stages StageLatency) {
+	labelNames := append(append([]string{}, probeLabelNames...), "stage")
+	for i, d := range stages.durations() {
+		if d > 0 {
+			promLatency(StageLatencyGaugeOpt(), labelNames, append(labels.values(), stageNames[i]), d, probeRunID(ctx))
+		}
+	}
+}
+
+// PromLatencyPercentiles exposes the percentiles of the message latencies of a pubsub probe run to Prometheus
+func PromLatencyPercentiles(labels ProbeLabels, percentiles LatencyPercentiles) {
+	gauge := gaugeVec(LatencyPercentileGaugeOpt(), append(append([]string{}, probeLabelNames...), "percentile"))
+	for i, d := range percentiles.durations() {
+		gauge.WithLabelValues(append(labels.values(), percentileNames[i])...).Set(float64(d) / float64(time.Millisecond))
+	}
+}
+
+func promLatency(opt prometheus.GaugeOpts, labelNames, labelValues []string, latency time.Duration, runID string) {
+	ms := float64(latency) / float64(time.Millisecond)
+	gaugeVec(opt, labelNames).WithLabelValues(labelValues...).Set(ms)
+	observer := histogramVec(opt, labelNames).WithLabelValues(labelValues...)
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && runID != "" {
+		eo.ObserveWithExemplar(ms, prometheus.Labels{"run_id": runID})
+	} else {
+		observer.Observe(ms)
+	}
+}
+
+// gaugeVec returns the registered gauge vector, it is registered with the label names on first use
+func gaugeVec(opt prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
 	key := getMetricKey(opt)
-	ms := float64(latency / time.Millisecond)
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
 	if promMetric, ok := metrics[key]; ok {
-		promMetric.WithLabelValues(cluster).Set(ms)
-	} else {
-		newMetric := prometheus.NewGaugeVec(opt, []string{"device"})
-		prometheus.Register(newMetric)
-		newMetric.WithLabelValues(cluster).Set(ms)
-		metrics[key] = newMetric
+		return promMetric
 	}
+	opt.ConstLabels = constLabels()
+	newMetric := prometheus.NewGaugeVec(opt, labelNames)
+	prometheus.Register(newMetric)
+	metrics[key] = newMetric
+	return newMetric
+}
 
-	if summary, ok := summaries[key]; ok {
-		summary.WithLabelValues(cluster).Observe(ms)
-	} else {
-		newSummary := prometheus.NewSummaryVec(prometheus.SummaryOpts{
-			Namespace:  opt.Namespace,
-			Subsystem:  opt.Subsystem,
-			Name:       fmt.Sprintf("%s_hst", opt.Name),
-			Help:       opt.Help,
-			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
-			MaxAge:     30 * time.Minute,
-			AgeBuckets: 3,
-			BufCap:     500,
-		}, []string{"device"})
-		prometheus.MustRegister(newSummary)
-		newSummary.WithLabelValues(cluster).Observe(ms)
-		summaries[key] = newSummary
+// counterVec returns the registered counter vector, it is registered with the label names on first use
+func counterVec(opt prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	key := fmt.Sprintf("%s-%s-%s", opt.Namespace, opt.Subsystem, opt.Name)
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	if promMetric, ok := counters[key]; ok {
+		return promMetric
+	}
+	opt.ConstLabels = constLabels()
+	newMetric := prometheus.NewCounterVec(opt, labelNames)
+	prometheus.Register(newMetric)
+	counters[key] = newMetric
+	return newMetric
+}
+
+// histogramVec returns the registered latency histogram vector of the gauge
+// The histograms can be aggregated across the monitor replicas, unlike summaries.
+func histogramVec(opt prometheus.GaugeOpts, labelNames []string) *prometheus.HistogramVec {
+	key := getMetricKey(opt)
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	if histogram, ok := histograms[key]; ok {
+		return histogram
 	}
+	newHistogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   opt.Namespace,
+		Subsystem:   opt.Subsystem,
+		Name:        fmt.Sprintf("%s_hst", opt.Name),
+		Help:        opt.Help,
+		ConstLabels: constLabels(),
+		Buckets:     latencyBuckets(),
+	}, labelNames)
+	prometheus.MustRegister(newHistogram)
+	histograms[key] = newHistogram
+	return newHistogram
+}
 
+// latencyBuckets returns the configured latency histogram buckets in milliseconds
+func latencyBuckets() []float64 {
+	if buckets := GetConfig().PrometheusConfig.LatencyBucketsMs; len(buckets) > 0 {
+		return buckets
+	}
+	return defaultLatencyBucketsMs
+}
+
+// MetricsHandler serves the metrics in the OpenMetrics format if it is accepted, it is required for the exemplars
+func MetricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
 }
 
 func getMetricKey(opt prometheus.GaugeOpts) string {
@@ -207,107 +428,6 @@ func GetOfflinePodsCounter(subsystem string) prometheus.GaugeOpts {
 	}
 }
 
-// scrapeLocal scrapes the local metrics
-func scrapeLocal() ([]byte, error) {
-	url := "http://localhost" + GetConfig().PrometheusConfig.Port + "/metrics"
-	newRequest, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		log.Errorf("make http request to scrape self's prometheus %s error %v", url, err)
-		return []byte{}, err
-	}
-	client := &http.Client{}
-	response, err := client.Do(newRequest)
-	if response != nil {
-		defer response.Body.Close()
-	}
-	if err != nil {
-		log.Errorf("scrape self's prometheus %s error %v", url, err)
-		return []byte{}, err
-	}
-
-	if response.StatusCode != http.StatusOK {
-		log.Errorf("scrape self's prometheus %s response status code %d", url, response.StatusCode)
-		return []byte{}, err
-	}
-
-	body, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		log.Errorf("scrape self's prometheus %s read response body error %v", url, err)
-		return []byte{}, err
-	}
-
-	var rc string
-	scanner := bufio.NewScanner(strings.NewReader(string(body)))
-
-	pattern := fmt.Sprintf(`.*pulsar.*`)
-	for scanner.Scan() {
-		text := scanner.Text()
-		matched, err := regexp.MatchString(pattern, text)
-		if matched && err == nil {
-			rc = fmt.Sprintf("%s%s\n", rc, text)
-		}
-	}
-	return []byte(strings.TrimSuffix(rc, "\n")), nil
-}
-
-// PushToPrometheusProxy pushes exp data to PrometheusProxy
-func PushToPrometheusProxy(proxyURL, authKey string) error {
-	data, err := scrapeLocal()
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", proxyURL, bytes.NewBuffer(data))
-	if err != nil {
-		log.Errorf("push to prometheus proxy %s error NewRe	uest request %v", proxyURL, err)
-		return err
-	}
-
-	req.Header.Set("Authorization", authKey)
-
-	client := &http.Client{Timeout: time.Second * 50}
-
-	// Send request
-	resp, err := client.Do(req)
-	if resp != nil {
-		defer resp.Body.Close()
-	}
-	if err != nil {
-		log.Errorf("push to prometheus proxy %s error reading request %v", proxyURL, err)
-		return err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Errorf("push to prometheus proxy %s error status code %v", proxyURL, resp.StatusCode)
-		return fmt.Errorf("push to prometheus proxy %s error status code %v", proxyURL, resp.StatusCode)
-	}
-
-	return nil
-}
-
-// PushToPrometheusProxyThread is the daemon thread that scrape and pushes metrics to prometheus proxy
-func PushToPrometheusProxyThread() {
-	promCfg := GetConfig().PrometheusConfig
-	if promCfg.PrometheusProxyURL == "" || !promCfg.ExposeMetrics {
-		log.Infof("This process is not configured to push metrics to prometheus proxy.")
-		return
-	}
-	proxyInstanceURL := promCfg.PrometheusProxyURL + "/" + GetConfig().Name
-
-	log.Infof("push to prometheus proxy url %s %t", GetConfig().PrometheusConfig.PrometheusProxyURL, promCfg.ExposeMetrics)
-	go func(url, apikey string) {
-		ticker := time.NewTicker(10 * time.Second)
-		PushToPrometheusProxy(url, apikey)
-		for {
-			select {
-			case <-ticker.C:
-				PushToPrometheusProxy(url, apikey)
-			}
-		}
-	}(proxyInstanceURL, promCfg.PrometheusProxyAPIKey)
-
-}
-
 // BuildTenantsUsageThread is the daemon thread that builds last 30s tenants usage and expose to Prometheus metrics
 func BuildTenantsUsageThread() {
 	token := GetConfig().Token
@@ -327,35 +447,22 @@ func BuildTenantsUsageThread() {
 	interval := time.Duration(metering.SamplingIntervalInSeconds) * time.Second
 
 	log.Infof("build tenants uages from %s", prefixURL)
-	go func(url, jwt, cluster string) {
-		ticker := time.NewTicker(interval)
-		usage := metering.NewTenantsUsage(url, jwt, cluster, tenantBytesOutAlertLimit)
+	s := getScheduler()
+	s.Go(func() {
+		usage := metering.NewTenantsUsage(prefixURL, token, name, tenantBytesOutAlertLimit)
 		usage.UpdateUsages()
-		errStr := usage.ReportHighUsageTenant()
-		if errStr != "" {
-			Alert(errStr)
+		reportHighUsage := func() {
+			if errStr := usage.ReportHighUsageTenant(); errStr != "" {
+				Alert(errStr)
+			}
 		}
+		reportHighUsage()
 
 		// monitor and report over limit tenant's usage
-		go func() {
-			alertInterval := util.TimeDuration(GetConfig().TenantUsageConfig.AlertIntervalMinutes, 120, time.Minute)
-			usageAlertTicker := time.NewTicker(alertInterval)
-			select {
-			case <-usageAlertTicker.C:
-				errStr := usage.ReportHighUsageTenant()
-				if errStr != "" {
-					Alert(errStr)
-				}
-			}
-
-		}()
+		alertInterval := util.TimeDuration(GetConfig().TenantUsageConfig.AlertIntervalMinutes, 120, time.Minute)
+		s.Every(alertInterval, false, reportHighUsage)
 
 		// calculate tenant usage and send to prometheus
-		for {
-			select {
-			case <-ticker.C:
-				usage.UpdateUsages()
-			}
-		}
-	}(prefixURL, token, name)
+		s.Every(interval, false, usage.UpdateUsages)
+	})
 }
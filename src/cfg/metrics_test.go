@@ -0,0 +1,142 @@
+package cfg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPayloadSizeClass(t *testing.T) {
+	assert(t, "small" == payloadSizeClass(nil), "default payload")
+	assert(t, "small" == payloadSizeClass([]string{"200B", "1KB"}), "small payloads")
+	assert(t, "medium" == payloadSizeClass([]string{"200B", "10KB"}), "the largest payload is classified")
+	assert(t, "large" == payloadSizeClass([]string{"1MB"}), "large payload")
+	assert(t, "xlarge" == payloadSizeClass([]string{"5MB"}), "extra large payload")
+}
+
+func TestProbeMetricLabels(t *testing.T) {
+	saved := GetConfig()
+	defer setConfig(saved)
+	setConfig(&Configuration{PrometheusConfig: PrometheusCfg{Labels: map[string]string{"region": "test-region"}}})
+
+	opt := MsgLatencyGaugeOpt("label_test", "probe label test latency")
+	cluster := "broker.example.com"
+	first := topicProbeLabels(cluster, TopicCfg{Name: "first", TopicName: "persistent://public/default/first"})
+	second := topicProbeLabels(cluster, TopicCfg{Name: "second", TopicName: "persistent://public/default/second", PayloadSizes: []string{"2MB"}})
+	assert(t, "xlarge" == second.SizeClass, "size class label %s", second.SizeClass)
+	PromProbeLatency(context.Background(), opt, first, 10*time.Millisecond)
+	PromProbeLatency(context.Background(), opt, second, 20*time.Millisecond)
+
+	gauge := gaugeVec(opt, probeLabelNames)
+	assert(t, 2 == testutil.CollectAndCount(gauge), "probes on the same cluster are separate series")
+	assert(t, 10 == testutil.ToFloat64(gauge.WithLabelValues(first.values()...)), "first probe latency")
+	assert(t, 20 == testutil.ToFloat64(gauge.WithLabelValues(second.values()...)), "second probe latency")
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	errNil(t, err)
+	found := false
+	for _, f := range families {
+		if f.GetName() != "pulsar_label_test_latency_ms" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				found = found || (l.GetName() == "region" && l.GetValue() == "test-region")
+			}
+		}
+	}
+	assert(t, found, "static labels are added to the metrics")
+}
+
+func TestProbeLatencyHistogram(t *testing.T) {
+	saved := GetConfig()
+	defer setConfig(saved)
+	setConfig(&Configuration{PrometheusConfig: PrometheusCfg{LatencyBucketsMs: []float64{10, 100}}})
+	defer reconcileProbes(nil)
+
+	opt := MsgLatencyGaugeOpt("histogram_test", "probe histogram test latency")
+	labels := ProbeLabels{Device: "cluster", Probe: "histogram-probe", Type: ProbeTypePubSub}
+	p := registerProbe(&Probe{Name: "histogram-probe", Type: ProbeTypePubSub, Interval: time.Minute, run: func(ctx context.Context) {
+		PromProbeLatency(ctx, opt, labels, 50*time.Millisecond)
+	}})
+	p.Run()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, req)
+	body := rec.Body.String()
+	assert(t, strings.Contains(body, "# TYPE pulsar_histogram_test_latency_ms_hst histogram"), "latency histogram")
+	assert(t, strings.Contains(body, `pulsar_histogram_test_latency_ms_hst_bucket{device="cluster",probe="histogram-probe",size_class="",topic="",type="pubsub",le="10.0"} 0`),
+		"configured buckets")
+	assert(t, strings.Contains(body, `le="100.0"} 1 # {run_id="`), "the observation carries the run id exemplar\n%s", body)
+}
+
+func TestProbeOutcomeCounters(t *testing.T) {
+	name := "outcome-probe"
+	recordProbeResult(name, ProbeTypePubSub, time.Millisecond, nil)
+	recordProbeResult(name, ProbeTypePubSub, time.Millisecond, probeError(reasonSubscribe, errors.New("subscribe error")))
+	recordProbeResult(name, ProbeTypePubSub, time.Millisecond,
+		fmt.Errorf("wrapped %w", probeError(reasonOutOfOrder, errors.New("out of order"))))
+	recordProbeResult(name, ProbeTypePubSub, time.Millisecond, context.DeadlineExceeded)
+	recordProbeResult(name, ProbeTypePubSub, time.Millisecond, errors.New("unclassified"))
+
+	runs := counterVec(ProbeRunsCounterOpt(), []string{"probe", "type"})
+	assert(t, 5 == testutil.ToFloat64(runs.WithLabelValues(name, ProbeTypePubSub)), "probe runs")
+	successes := counterVec(ProbeSuccessesCounterOpt(), []string{"probe", "type"})
+	assert(t, 1 == testutil.ToFloat64(successes.WithLabelValues(name, ProbeTypePubSub)), "probe successes")
+	failures := counterVec(ProbeFailuresCounterOpt(), []string{"probe", "type", "reason"})
+	for _, reason := range []string{reasonSubscribe, reasonOutOfOrder, reasonTimeout, reasonUnknown} {
+		assert(t, 1 == testutil.ToFloat64(failures.WithLabelValues(name, ProbeTypePubSub, reason)), "probe failures for %s", reason)
+	}
+	assert(t, "subscribe error" == probeError(reasonSubscribe, errors.New("subscribe error")).Error(), "the reason is not in the error message")
+}
+
+func TestStageLatency(t *testing.T) {
+	stages := StageLatency{Connect: time.Millisecond, ProducerCreate: 20 * time.Millisecond, PublishAck: 5 * time.Millisecond, EndToEnd: 9 * time.Millisecond}
+	assert(t, "connect 1ms, producer_create 20ms, subscribe 0s, publish_ack 5ms, end_to_end 9ms" == stages.String(), "stages %v", stages)
+
+	labels := ProbeLabels{Device: "stage-cluster", Probe: "stage-probe", Type: ProbeTypePubSub}
+	PromStageLatency(context.Background(), labels, stages)
+	gauge := gaugeVec(StageLatencyGaugeOpt(), append(append([]string{}, probeLabelNames...), "stage"))
+	assert(t, 4 == testutil.CollectAndCount(gauge), "only the measured stages are exposed")
+	assert(t, 20 == testutil.ToFloat64(gauge.WithLabelValues(append(labels.values(), "producer_create")...)), "producer create latency")
+	assert(t, 9 == testutil.ToFloat64(gauge.WithLabelValues(append(labels.values(), "end_to_end")...)), "end to end latency")
+
+	PromStageLatency(context.Background(), labels, StageLatency{Connect: 250 * time.Microsecond})
+	assert(t, 0.25 == testutil.ToFloat64(gauge.WithLabelValues(append(labels.values(), "connect")...)), "sub millisecond connect latency")
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	latencies := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	p := latencyPercentiles(latencies)
+	assert(t, time.Millisecond == p.Min && 100*time.Millisecond == p.Max, "min and max %v", p)
+	assert(t, 50*time.Millisecond == p.P50 && 95*time.Millisecond == p.P95 && 99*time.Millisecond == p.P99, "nearest rank percentiles %v", p)
+	assert(t, 100*time.Millisecond == latencies[0], "the latencies are not sorted in place")
+	assert(t, LatencyPercentiles{} == latencyPercentiles(nil), "no percentiles without messages")
+
+	result := MsgResult{Latency: 60 * time.Millisecond, Percentiles: p}
+	assert(t, 60*time.Millisecond == result.budgetLatency(""), "the mean is the default budget latency")
+	assert(t, 60*time.Millisecond == result.budgetLatency(meanLatency), "mean budget latency")
+	assert(t, 95*time.Millisecond == result.budgetLatency("p95"), "p95 budget latency")
+
+	labels := ProbeLabels{Device: "percentile-cluster", Probe: "percentile-probe", Type: ProbeTypePubSub}
+	PromLatencyPercentiles(labels, p)
+	gauge := gaugeVec(LatencyPercentileGaugeOpt(), append(append([]string{}, probeLabelNames...), "percentile"))
+	assert(t, 5 == testutil.CollectAndCount(gauge), "a series per percentile")
+	assert(t, 99 == testutil.ToFloat64(gauge.WithLabelValues(append(labels.values(), "p99")...)), "p99 latency")
+
+	PromLatencyPercentiles(labels, LatencyPercentiles{P50: 1500 * time.Microsecond})
+	assert(t, 1.5 == testutil.ToFloat64(gauge.WithLabelValues(append(labels.values(), "p50")...)), "sub millisecond p50 latency")
+}
@@ -0,0 +1,154 @@
+package cfg
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+// alert sinks are the destinations of incidents and alert messages.
+// Every sink type registers a factory, the factory builds an active sink
+// when the sink's configuration is present. Multiple sinks can be active at once.
+
+// IncidentSink receives incident lifecycle events, usually a paging system
+type IncidentSink interface {
+	// Name is the unique sink name
+	Name() string
+	// CreateIncident opens an incident and returns a sink specific reference
+	// that is passed to the subsequent update and resolve calls
+	CreateIncident(incident Incident) (string, error)
+	// UpdateIncident reports an incident that is still open
+	UpdateIncident(incident Incident, ref string) error
+	// ResolveIncident closes an open incident
+	ResolveIncident(incident Incident, ref string) error
+}
+
+// Notifier sends plain alert messages, usually to a chat channel
+type Notifier interface {
+	Name() string
+	Notify(msg string) error
+}
+
+// SinkFactory builds a sink from the configuration.
+// It returns nil if the sink is not configured.
+type SinkFactory func(config *Configuration) IncidentSink
+
+var (
+	// key is the sink name
+	sinkFactories     = make(map[string]SinkFactory)
+	sinkFactoriesLock = &sync.RWMutex{}
+
+	incidentSinks = []IncidentSink{}
+	notifiers     = []Notifier{}
+	sinksLock     = &sync.RWMutex{}
+
+	// the notifications and events being sent in the background
+	pendingNotifications sync.WaitGroup
+)
+
+func init() {
+	RegisterSinkFactory(slackSinkName, newSlackSink)
+	RegisterSinkFactory(opsGenieSinkName, newOpsGenieSink)
+	RegisterSinkFactory(pagerDutySinkName, newPagerDutySink)
+}
+
+// notifyAsync sends a notification or an event in the background
+func notifyAsync(send func()) {
+	pendingNotifications.Add(1)
+	go func() {
+		defer pendingNotifications.Done()
+		send()
+	}()
+}
+
+// FlushNotifications waits for the notifications being sent in the background
+// It returns false if they are not sent within the timeout.
+func FlushNotifications(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		pendingNotifications.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// RegisterSinkFactory registers a sink type by name
+func RegisterSinkFactory(name string, factory SinkFactory) {
+	sinkFactoriesLock.Lock()
+	defer sinkFactoriesLock.Unlock()
+	sinkFactories[name] = factory
+}
+
+// SetupAlertSinks activates all configured sinks.
+// `alertSinks` in the configuration restricts the active sinks to the listed names.
+func SetupAlertSinks() {
+	config := GetConfig()
+
+	sinkFactoriesLock.RLock()
+	names := make([]string, 0, len(sinkFactories))
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+	sinkFactoriesLock.RUnlock()
+	sort.Strings(names)
+
+	sinks := []IncidentSink{}
+	msgNotifiers := []Notifier{}
+	for _, name := range names {
+		if len(config.AlertSinks) > 0 && !util.StrContains(config.AlertSinks, name) {
+			continue
+		}
+		sinkFactoriesLock.RLock()
+		factory := sinkFactories[name]
+		sinkFactoriesLock.RUnlock()
+
+		sink := factory(config)
+		if sink == nil {
+			continue
+		}
+		log.Infof("alert sink %s is active", name)
+		sinks = append(sinks, sink)
+		if notifier, ok := sink.(Notifier); ok {
+			msgNotifiers = append(msgNotifiers, notifier)
+		}
+	}
+
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	incidentSinks = sinks
+	notifiers = msgNotifiers
+}
+
+// RegisterIncidentSink adds an active incident sink
+func RegisterIncidentSink(sink IncidentSink) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	incidentSinks = append(incidentSinks, sink)
+}
+
+// RegisterNotifier adds an active alert message notifier
+func RegisterNotifier(notifier Notifier) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	notifiers = append(notifiers, notifier)
+}
+
+func getIncidentSinks() []IncidentSink {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	return append([]IncidentSink{}, incidentSinks...)
+}
+
+func getNotifiers() []Notifier {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	return append([]Notifier{}, notifiers...)
+}
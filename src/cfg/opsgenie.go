@@ -0,0 +1,323 @@
+package cfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+const (
+	opsGenieAlertURL = "https://api.opsgenie.com/v2/alerts"
+	opsGenieSinkName = "opsgenie"
+)
+
+// OpsGenieAlertCreateResponse is the response struct returned by OpsGenie
+// https://docs.opsgenie.com/docs/alert-api#section-create-alert
+type OpsGenieAlertCreateResponse struct {
+	Result    string  `json:"result"`
+	Took      float64 `json:"took"`
+	RequestID string  `json:"requestId"`
+}
+
+// OpsGenieAlertGetResponse is the response struct returned by OpsGenie
+// https://docs.opsgenie.com/docs/alert-api#section-create-alert
+type OpsGenieAlertGetResponse struct {
+	Data      alertGetData `json:"data"`
+	Took      float64      `json:"took"`
+	RequestID string       `json:"requestId"`
+}
+
+// alertGetData is data part of OpsGenieAlertGetResponse
+// only creates the attributes that we are interested
+type alertGetData struct {
+	Success   bool   `json:"success"`
+	IsSuccess bool   `json:"isSuccess"`
+	Status    string `json:"status"`
+	AlertID   string `json:"alertId"`
+	Alias     string `json:"alias"`
+}
+
+// OpsGenieAlertCloseRequest is the POST request payload json
+type OpsGenieAlertCloseRequest struct {
+	User   string `json:"user"`
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+// OpsGenieSink creates and closes OpsGenie alerts
+// The sink reference of an incident is the OpsGenie request id.
+type OpsGenieSink struct {
+	genieKey string
+	// key is the request id, value is the alert id
+	alertIDs *util.SyncMap
+}
+
+func newOpsGenieSink(config *Configuration) IncidentSink {
+	if config.OpsGenieConfig.AlertKey == "" {
+		return nil
+	}
+	return &OpsGenieSink{
+		genieKey: config.OpsGenieConfig.AlertKey,
+		alertIDs: util.NewSycMap(),
+	}
+}
+
+// Name returns the sink name
+func (s *OpsGenieSink) Name() string {
+	return opsGenieSinkName
+}
+
+// CreateIncident creates an OpsGenie alert
+func (s *OpsGenieSink) CreateIncident(incident Incident) (string, error) {
+	requestID, err := CreateOpsGenieAlert(incident, s.genieKey)
+	if err != nil {
+		return "", err
+	}
+
+	// there is a delay when the alert is created by opsgenie, so we use retry
+	// time out has to be less than the latency time interval
+	notifyAsync(func() {
+		if alertID, err := getOpsGenieAlertIDRetry(incident.Entity, requestID, s.genieKey, 4*time.Second); err == nil {
+			s.alertIDs.Put(requestID, alertID)
+		}
+	})
+	return requestID, nil
+}
+
+// UpdateIncident adds a note to the open OpsGenie alert
+func (s *OpsGenieSink) UpdateIncident(incident Incident, ref string) error {
+	alertID, err := s.alertID(incident.Entity, ref)
+	if err != nil {
+		return err
+	}
+	return AddOpsGenieAlertNote(incident.Entity, alertID, incident.Description, s.genieKey)
+}
+
+// ResolveIncident closes the OpsGenie alert
+func (s *OpsGenieSink) ResolveIncident(incident Incident, ref string) error {
+	alertID, err := s.alertID(incident.Entity, ref)
+	if err != nil {
+		return err
+	}
+	log.Infof("auto close %s alertID %s", incident.Entity, alertID)
+	if err := CloseOpsGenieAlert(incident.Entity, alertID, s.genieKey); err != nil {
+		return err
+	}
+	s.alertIDs.Remove(ref)
+	return nil
+}
+
+// IsIncidentOpen checks whether the OpsGenie alert is still open
+func (s *OpsGenieSink) IsIncidentOpen(incident Incident, ref string) (bool, error) {
+	alertID, err := s.alertID(incident.Entity, ref)
+	if err != nil {
+		return false, err
+	}
+	status, err := getOpsGenieAlertStatus(alertID, s.genieKey)
+	if err != nil {
+		return false, err
+	}
+	return status != "closed", nil
+}
+
+// alertID looks up the alert id of a request id, it queries OpsGenie if the alert id is not known yet
+func (s *OpsGenieSink) alertID(entity, requestID string) (string, error) {
+	if alertID, ok := s.alertIDs.Get(requestID).(string); ok && alertID != "" {
+		return alertID, nil
+	}
+	alertID, err := getOpsGenieAlertIDRetry(entity, requestID, s.genieKey, 4*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("%s unable to identify alert with request id %s, error %v", entity, requestID, err)
+	}
+	s.alertIDs.Put(requestID, alertID)
+	return alertID, nil
+}
+
+func opsGenieHTTP(method, endpoint, genieKey string, payload *bytes.Buffer) (*http.Response, error) {
+	if genieKey == "" {
+		errStr := fmt.Sprintf("Alert creation failed. %s has not configured with genieKey.", GetConfig().Name)
+		Alert(errStr)
+		return nil, fmt.Errorf(errStr)
+	}
+
+	client := retryablehttp.NewClient()
+	client.HTTPClient.Timeout = time.Duration(5) * time.Second
+	client.RetryWaitMin = 4 * time.Second
+	client.RetryWaitMax = 64 * time.Second
+	client.RetryMax = 2
+
+	log.Infof("method %v request URL %v", method, opsGenieAlertURL+endpoint)
+	req, err := retryablehttp.NewRequest(method, opsGenieAlertURL+endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", genieKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	return client.Do(req)
+}
+
+// CreateOpsGenieAlert creates an OpsGenie alert and returns the request id
+func CreateOpsGenieAlert(msg Incident, genieKey string) (string, error) {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := opsGenieHTTP(http.MethodPost, "", genieKey, bytes.NewBuffer(buf))
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode > 300 {
+		return "", fmt.Errorf("Create Opsgenie alert returns incorrect status code %d", resp.StatusCode)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	alertResp := OpsGenieAlertCreateResponse{}
+	err = json.Unmarshal(bodyBytes, &alertResp)
+	if err != nil {
+		return "", err
+	}
+
+	return alertResp.RequestID, nil
+}
+
+func getOpsGenieAlertIDRetry(entity, requestID, genieKey string, timeout time.Duration) (string, error) {
+	start := time.Now()
+	err := fmt.Errorf("timed out")
+	for time.Since(start) < timeout {
+		time.Sleep(200 * time.Millisecond) //TODO: could have exponatial back off retry
+		var alertID string
+		alertID, err = getOpsGenieAlertID(requestID, genieKey)
+		if err == nil {
+			log.Infof("%s found alertId %s with requestId %s", entity, alertID, requestID)
+			return alertID, nil
+		}
+	}
+	log.Errorf("%s unable to find alert with requestId %s", entity, requestID)
+	return "", err
+}
+
+// getOpsGenieAlertID gets alertID from a created alert.
+// alertID is used for alert clear purpose
+func getOpsGenieAlertID(requestID, genieKey string) (alertID string, err error) {
+	resp, err := opsGenieHTTP(http.MethodGet, "/requests/"+requestID, genieKey, &bytes.Buffer{})
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode > 300 {
+		return "", fmt.Errorf("Get Opsgenie alert returns incorrect status code %d", resp.StatusCode)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	alertResp := OpsGenieAlertGetResponse{}
+	err = json.Unmarshal(bodyBytes, &alertResp)
+	if err != nil {
+		return "", err
+	}
+
+	if alertResp.Data.AlertID == "" {
+		return "", fmt.Errorf("alert with requestId %s has not been created yet", requestID)
+	}
+	return alertResp.Data.AlertID, nil
+}
+
+// getOpsGenieAlertStatus gets the status of an alert, i.e. open or closed
+func getOpsGenieAlertStatus(alertID, genieKey string) (string, error) {
+	resp, err := opsGenieHTTP(http.MethodGet, fmt.Sprintf("/%s?identifierType=id", alertID), genieKey, &bytes.Buffer{})
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode > 300 {
+		return "", fmt.Errorf("Get Opsgenie alert status returns incorrect status code %d", resp.StatusCode)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	alertResp := OpsGenieAlertGetResponse{}
+	if err = json.Unmarshal(bodyBytes, &alertResp); err != nil {
+		return "", err
+	}
+	return alertResp.Data.Status, nil
+}
+
+// AddOpsGenieAlertNote adds a note to an OpsGenie alert
+func AddOpsGenieAlertNote(component, alertID, note, genieKey string) error {
+	buf, err := json.Marshal(OpsGenieAlertCloseRequest{
+		User:   "pulsar monitor",
+		Source: component,
+		Note:   note,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := opsGenieHTTP(http.MethodPost, fmt.Sprintf("/%s/notes?identifierType=id", alertID), genieKey, bytes.NewBuffer(buf))
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode > 300 {
+		return fmt.Errorf("Add note to Opsgenie alert returns incorrect status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// CloseOpsGenieAlert deletes an OpsGenie alert
+func CloseOpsGenieAlert(component, alertID string, genieKey string) error {
+	buf, err := json.Marshal(OpsGenieAlertCloseRequest{
+		User:   "pulsar monitor",
+		Source: component,
+		Note:   "*automatically resolved the alert* (alertId) " + alertID,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := opsGenieHTTP(http.MethodPost, fmt.Sprintf("/%s/close?identifierType=id", alertID), genieKey, bytes.NewBuffer(buf))
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode > 300 {
+		return fmt.Errorf("Close Opsgenie alert returns incorrect status code %d", resp.StatusCode)
+	}
+	return nil
+}
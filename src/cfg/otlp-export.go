@@ -0,0 +1,52 @@
+package cfg
+
+import (
+	"context"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+// OTLPExportThread is the daemon thread that exports the probe runs as traces and metrics to the OpenTelemetry collector
+// It must start before the probes so their runs are traced.
+func OTLPExportThread() {
+	c := GetConfig().OTLPConfig
+	if c.Endpoint == "" {
+		log.Infof("This process is not configured to export traces to an OpenTelemetry collector.")
+		return
+	}
+
+	attrs := map[string]string{"service.instance.id": GetConfig().Name}
+	for k, v := range c.ResourceAttributes {
+		attrs[k] = v
+	}
+	exporter := otlp.NewExporter(otlp.Config{
+		Endpoint:           c.Endpoint,
+		Headers:            c.Headers,
+		ResourceAttributes: attrs,
+		Timeout:            util.TimeDuration(c.TimeoutSeconds, 10, time.Second),
+		BoundsMs:           GetConfig().PrometheusConfig.LatencyBucketsMs,
+	})
+	otlp.SetExporter(exporter)
+	log.Infof("export probe traces to the OpenTelemetry collector %s", c.Endpoint)
+	RunInterval(func() {
+		if err := exporter.Flush(context.Background()); err != nil {
+			log.Errorf("otlp export error %v", err)
+		}
+	}, util.TimeDuration(c.IntervalSeconds, 10, time.Second))
+}
+
+// flushOTLPExport exports the spans of the last probe runs, it is called on shutdown
+func flushOTLPExport(timeout time.Duration) {
+	exporter := otlp.GetExporter()
+	if exporter == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := exporter.Flush(ctx); err != nil {
+		log.Errorf("otlp export on shutdown error %v", err)
+	}
+}
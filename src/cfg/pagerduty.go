@@ -0,0 +1,183 @@
+package cfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+// PagerDuty Events API v2
+// https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	pagerDutySinkName  = "pagerduty"
+
+	pagerDutyTrigger = "trigger"
+	pagerDutyResolve = "resolve"
+)
+
+// PagerDutyEvent is the Events API v2 request payload
+type PagerDutyEvent struct {
+	RoutingKey  string                 `json:"routing_key"`
+	EventAction string                 `json:"event_action"`
+	DedupKey    string                 `json:"dedup_key,omitempty"`
+	Payload     *PagerDutyEventPayload `json:"payload,omitempty"`
+}
+
+// PagerDutyEventPayload is the alert detail of a trigger event
+type PagerDutyEventPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// PagerDutyEventResponse is the response returned by the Events API v2
+type PagerDutyEventResponse struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	DedupKey string `json:"dedup_key"`
+}
+
+// PagerDutySink triggers and resolves PagerDuty incidents.
+// The sink reference of an incident is the dedup key derived from the incident,
+// so the incident can be resolved without looking up any PagerDuty generated id.
+type PagerDutySink struct {
+	routingKey string
+	eventsURL  string
+}
+
+func newPagerDutySink(config *Configuration) IncidentSink {
+	if config.PagerDutyConfig.IntegrationKey == "" {
+		return nil
+	}
+	return &PagerDutySink{
+		routingKey: config.PagerDutyConfig.IntegrationKey,
+		eventsURL:  util.AssignString(config.PagerDutyConfig.EventsURL, pagerDutyEventsURL),
+	}
+}
+
+// Name returns the sink name
+func (s *PagerDutySink) Name() string {
+	return pagerDutySinkName
+}
+
+// CreateIncident sends a trigger event
+func (s *PagerDutySink) CreateIncident(incident Incident) (string, error) {
+	return s.trigger(incident, pagerDutyDedupKey(incident))
+}
+
+// UpdateIncident sends another trigger event with the same dedup key,
+// PagerDuty appends it to the open incident
+func (s *PagerDutySink) UpdateIncident(incident Incident, ref string) error {
+	_, err := s.trigger(incident, util.AssignString(ref, pagerDutyDedupKey(incident)))
+	return err
+}
+
+// ResolveIncident sends a resolve event
+func (s *PagerDutySink) ResolveIncident(incident Incident, ref string) error {
+	_, err := s.send(PagerDutyEvent{
+		RoutingKey:  s.routingKey,
+		EventAction: pagerDutyResolve,
+		DedupKey:    util.AssignString(ref, pagerDutyDedupKey(incident)),
+	})
+	return err
+}
+
+func (s *PagerDutySink) trigger(incident Incident, dedupKey string) (string, error) {
+	return s.send(PagerDutyEvent{
+		RoutingKey:  s.routingKey,
+		EventAction: pagerDutyTrigger,
+		DedupKey:    dedupKey,
+		Payload: &PagerDutyEventPayload{
+			Summary:   incident.Message,
+			Source:    util.AssignString(GetConfig().Name, "pulsar-monitor"),
+			Severity:  pagerDutySeverity(incident.Priority),
+			Timestamp: incident.Timestamp.Format(time.RFC3339),
+			Component: incident.Entity,
+			Group:     incident.Alias,
+			CustomDetails: map[string]string{
+				"description": incident.Description,
+				"priority":    incident.Priority,
+			},
+		},
+	})
+}
+
+// send posts an event and returns the dedup key of the incident
+func (s *PagerDutySink) send(event PagerDutyEvent) (string, error) {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	client := retryablehttp.NewClient()
+	client.HTTPClient.Timeout = time.Duration(5) * time.Second
+	client.RetryWaitMin = 4 * time.Second
+	client.RetryWaitMax = 64 * time.Second
+	client.RetryMax = 2
+
+	req, err := retryablehttp.NewRequest(http.MethodPost, s.eventsURL, bytes.NewBuffer(buf))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	log.Infof("pagerduty %s event dedup key %s", event.EventAction, event.DedupKey)
+	resp, err := client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode > 300 {
+		return "", fmt.Errorf("PagerDuty %s event returns incorrect status code %d", event.EventAction, resp.StatusCode)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	eventResp := PagerDutyEventResponse{}
+	if err = json.Unmarshal(bodyBytes, &eventResp); err != nil {
+		return "", err
+	}
+
+	return util.AssignString(eventResp.DedupKey, event.DedupKey), nil
+}
+
+// pagerDutyDedupKey derives a stable dedup key from the incident alias and entity
+func pagerDutyDedupKey(incident Incident) string {
+	if incident.Alias == "" || incident.Alias == incident.Entity {
+		return incident.Entity
+	}
+	return incident.Alias + "/" + incident.Entity
+}
+
+// pagerDutySeverity maps the incident priority to PagerDuty severity
+func pagerDutySeverity(priority string) string {
+	switch priority {
+	case "P1":
+		return "critical"
+	case "P2":
+		return "error"
+	case "P3":
+		return "warning"
+	default:
+		return "info"
+	}
+}
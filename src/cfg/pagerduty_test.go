@@ -0,0 +1,39 @@
+package cfg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPagerDutySink(t *testing.T) {
+	events := []PagerDutyEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := PagerDutyEvent{}
+		errNil(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(PagerDutyEventResponse{Status: "success", DedupKey: event.DedupKey})
+	}))
+	defer server.Close()
+
+	sink := newPagerDutySink(&Configuration{
+		PagerDutyConfig: PagerDutyCfg{IntegrationKey: "routing-key", EventsURL: server.URL},
+	})
+	assert(t, sink != nil, "pagerduty sink is configured")
+	assert(t, nil == newPagerDutySink(&Configuration{}), "pagerduty sink requires an integration key")
+
+	incident := NewIncident("cluster-a-websocket", "cluster-a", "persisted failure", "desc", "P1")
+	ref, err := sink.CreateIncident(incident)
+	errNil(t, err)
+	assert(t, "cluster-a/cluster-a-websocket" == ref, "dedup key derived from alias and entity")
+
+	errNil(t, sink.ResolveIncident(incident, ref))
+	assert(t, 2 == len(events), "trigger and resolve events")
+	assert(t, pagerDutyTrigger == events[0].EventAction && "critical" == events[0].Payload.Severity, "trigger event")
+	assert(t, "routing-key" == events[1].RoutingKey, "routing key")
+	assert(t, pagerDutyResolve == events[1].EventAction && ref == events[1].DedupKey, "resolve event with the same dedup key")
+
+	assert(t, "broker" == pagerDutyDedupKey(NewIncident("broker", "broker", "", "", "")), "dedup key is the entity")
+}
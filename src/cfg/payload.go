@@ -91,13 +91,41 @@ func NumOfBytes(size string) int {
 		return 0
 	}
 
+	multiplier, _ := payloadUnit(unit)
+	return bytes * multiplier
+}
+
+var payloadSizeRegex = regexp.MustCompile(`^\s*([0-9]+)\s*([a-zA-Z]*)\s*$`)
+
+// ParsePayloadSize strictly parses a payload size such as 200B, 10KB or 1MB
+// NumOfBytes treats an unknown unit as bytes and an unparsable size as 0.
+func ParsePayloadSize(size string) (int, error) {
+	matches := payloadSizeRegex.FindStringSubmatch(size)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid payload size %q, it must be a number followed by an optional unit B, KB or MB", size)
+	}
+	bytes, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid payload size %q, %v", size, err)
+	}
+	multiplier, ok := payloadUnit(matches[2])
+	if !ok {
+		return 0, fmt.Errorf("invalid payload size %q, unknown unit %s", size, matches[2])
+	}
+	return bytes * multiplier, nil
+}
+
+// payloadUnit returns the number of bytes of a unit, bytes is the default for an unknown unit
+func payloadUnit(unit string) (int, bool) {
 	switch strings.ToLower(unit) {
 	case "mb", "megabytes", "megabyte", "megab":
-		return bytes * 1024 * 1024
+		return 1024 * 1024, true
 	case "kb", "kilobytes", "kilobyte", "kilob":
-		return bytes * 1024
+		return 1024, true
+	case "", "b", "byte", "bytes":
+		return 1, true
 	default:
-		return bytes
+		return 1, false
 	}
 }
 
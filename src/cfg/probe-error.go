@@ -0,0 +1,62 @@
+package cfg
+
+import (
+	"context"
+	"errors"
+)
+
+// the normalized reasons of probe failures in the failure metrics
+const (
+	reasonConnect         = "connect_error"
+	reasonProducerCreate  = "producer_create_failure"
+	reasonSubscribe       = "subscribe_failure"
+	reasonSend            = "send_failure"
+	reasonReceive         = "receive_failure"
+	reasonReceiveTimeout  = "receive_timeout"
+	reasonOutOfOrder      = "out_of_order_delivery"
+	reasonOverBudget      = "over_budget"
+	reasonStddevAnomaly   = "stddev_anomaly"
+	reasonHTTPStatus      = "http_status_mismatch"
+	reasonExpr            = "expr_failure"
+	reasonInvalidResponse = "invalid_response"
+	reasonInvalidConfig   = "invalid_config"
+	reasonUnhealthy       = "unhealthy"
+	reasonTimeout         = "timeout"
+	reasonUnknown         = "unknown"
+)
+
+// ProbeError is a probe failure with a normalized reason
+type ProbeError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ProbeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// probeError wraps the error with the reason, it returns nil if the error is nil
+func probeError(reason string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ProbeError{Reason: reason, Err: err}
+}
+
+// probeErrorReason returns the normalized reason of a probe failure
+func probeErrorReason(err error) string {
+	var pe *ProbeError
+	switch {
+	case errors.As(err, &pe):
+		return pe.Reason
+	case errors.Is(err, context.DeadlineExceeded):
+		return reasonTimeout
+	default:
+		return reasonUnknown
+	}
+}
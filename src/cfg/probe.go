@@ -0,0 +1,501 @@
+package cfg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
+	"github.com/kafkaesque-io/pulsar-monitor/src/schedule"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+// Probe is a named monitor test, it runs on schedule and on demand
+type Probe struct {
+	Name string
+	Type string
+	// Component is the incident component reported by the probe
+	Component string
+	Interval  time.Duration
+	// Timeout is the hard timeout of a run, it is the interval by default
+	Timeout time.Duration
+	run     func(ctx context.Context)
+	// the scheduled runs are at every minute of the cron schedule instead of the interval if it is set
+	cron *schedule.Cron
+	// the scheduled runs are skipped outside the active hours if they are set
+	activeHours *schedule.Hours
+	// serializes the scheduled and on demand runs
+	lock sync.Mutex
+	// set while a run is in progress, including a timed out run that has not returned yet
+	running int32
+	// the probe replaced on reload, the runs wait for its run in progress to return
+	previous *Probe
+	// identifies the probe configuration, a reload restarts the probe if it changes
+	fingerprint string
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// ProbeStatus is the last result of a probe
+type ProbeStatus struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs float64   `json:"latencyMs"`
+	LastRunAt time.Time `json:"lastRunAt"`
+	// the last time the probe succeeded
+	LastSuccessAt time.Time `json:"lastSuccessAt"`
+	Runs          int       `json:"runs"`
+	Failures      int       `json:"failures"`
+}
+
+// ProbeSample is a probe result in the recent history
+type ProbeSample struct {
+	At        time.Time `json:"at"`
+	Healthy   bool      `json:"healthy"`
+	LatencyMs float64   `json:"latencyMs"`
+}
+
+// the number of samples kept in each probe history
+const probeHistorySize = 60
+
+// the time a timed out run is given to observe the cancellation and report its own result
+var probeCancelGrace = 2 * time.Second
+
+var (
+	// key is the probe id
+	probes     = make(map[string]*Probe)
+	probesLock = &sync.RWMutex{}
+
+	// key is the probe id
+	probeStatuses = make(map[string]ProbeStatus)
+	// key is the probe id, the recent samples in the order of run time
+	probeHistory      = make(map[string][]ProbeSample)
+	probeStatusesLock = &sync.RWMutex{}
+)
+
+// probeID identifies a probe, the names are unique within a probe type
+func probeID(probeType, name string) string {
+	return probeType + "/" + name
+}
+
+func (p *Probe) id() string {
+	return probeID(p.Type, p.Name)
+}
+
+// RegisterProbe registers a probe, it replaces the existing probe with the same type and name
+func RegisterProbe(name, probeType string, interval time.Duration, run func(ctx context.Context)) *Probe {
+	return registerProbe(&Probe{
+		Name:      name,
+		Type:      probeType,
+		Component: name,
+		Interval:  interval,
+		run:       run,
+	})
+}
+
+func registerProbe(p *Probe) *Probe {
+	p.stop = make(chan struct{})
+	probesLock.Lock()
+	defer probesLock.Unlock()
+	if _, ok := probes[p.id()]; ok {
+		log.Warnf("%s probe %s replaces the probe with the same name", p.Type, p.Name)
+	}
+	probes[p.id()] = p
+	return p
+}
+
+// GetProbe returns the registered probe by type and name
+func GetProbe(probeType, name string) (*Probe, bool) {
+	probesLock.RLock()
+	defer probesLock.RUnlock()
+	p, ok := probes[probeID(probeType, name)]
+	return p, ok
+}
+
+// GetProbes returns the registered probes sorted by type and name
+func GetProbes() []*Probe {
+	probesLock.RLock()
+	list := make([]*Probe, 0, len(probes))
+	for _, p := range probes {
+		list = append(list, p)
+	}
+	probesLock.RUnlock()
+
+	sortProbes(list)
+	return list
+}
+
+func sortProbes(list []*Probe) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Type != list[j].Type {
+			return list[i].Type < list[j].Type
+		}
+		return list[i].Name < list[j].Name
+	})
+}
+
+var (
+	// errProbeRunning is returned by a run while a timed out run of the probe or the replaced probe has not returned
+	errProbeRunning = errors.New("the previous run is still in progress")
+	// errProbeStopped is returned by a run of a stopped probe
+	errProbeStopped = errors.New("the probe is stopped")
+)
+
+// Run runs the probe and returns its result, it waits for a run in progress to complete
+// The probe is not run while an abandoned run has not returned, the last result and errProbeRunning are returned.
+func (p *Probe) Run() (ProbeStatus, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopped() {
+		return getProbeStatus(p.Type, p.Name), fmt.Errorf("%s probe %s is not run: %w", p.Type, p.Name, errProbeStopped)
+	}
+	if !p.previousDone() || !atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+		return getProbeStatus(p.Type, p.Name), fmt.Errorf("%s probe %s is not run: %w", p.Type, p.Name, errProbeRunning)
+	}
+	p.execute()
+	return getProbeStatus(p.Type, p.Name), nil
+}
+
+// previousDone waits for the runs in progress of the replaced probes to complete
+// It returns false while an abandoned run of a replaced probe has not returned. The replaced probes are stopped,
+// so they do not start another run once they are done.
+func (p *Probe) previousDone() bool {
+	if p.previous == nil {
+		return true
+	}
+	p.previous.lock.Lock()
+	done := p.previous.previousDone() && atomic.LoadInt32(&p.previous.running) == 0
+	p.previous.lock.Unlock()
+	if done {
+		p.previous = nil
+	}
+	return done
+}
+
+// runScheduled runs the probe unless the previous run is still in progress or it is outside the active hours
+func (p *Probe) runScheduled() {
+	if p.activeHours != nil && !p.activeHours.Contains(time.Now()) {
+		log.Debugf("%s probe %s is not run outside the active hours", p.Type, p.Name)
+		return
+	}
+	if _, err := p.Run(); errors.Is(err, errProbeRunning) {
+		log.Warnf("%s probe %s is skipped since the previous run is still in progress", p.Type, p.Name)
+		PromProbeCounter(ProbeSkippedCounterOpt(), p.metricLabels())
+	}
+}
+
+type runIDKey struct{}
+
+// probeRunID returns the id of the probe run in the context, it is empty outside a probe run
+func probeRunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// metricLabels are the labels of the probe in the scheduling metrics
+func (p *Probe) metricLabels() ProbeLabels {
+	return ProbeLabels{Device: p.Component, Probe: p.Name, Type: p.Type}
+}
+
+// timeout returns the hard timeout of a run, zero is no timeout
+func (p *Probe) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return p.Interval
+}
+
+// execute runs the probe with the hard timeout, the running flag is set by the caller
+// A run that does not return within the grace period after the timeout is recorded as a failure and abandoned,
+// the next runs are refused until it returns.
+func (p *Probe) execute() {
+	// the run id is attached to the latency observations as an exemplar
+	runID := newID()
+	parent, span := otlp.Start(context.WithValue(context.Background(), runIDKey{}, runID), p.Type+" probe",
+		otlp.String("probe.name", p.Name), otlp.String("probe.type", p.Type), otlp.String("run.id", runID))
+	start := time.Now()
+	defer func() {
+		if status := getProbeStatus(p.Type, p.Name); !status.Healthy && !status.LastRunAt.Before(start) {
+			span.RecordError(errors.New(status.Error))
+		}
+		span.End()
+	}()
+	ctx, cancel := context.WithCancel(parent)
+	timeout := p.timeout()
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer atomic.StoreInt32(&p.running, 0)
+		p.run(ctx)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	PromProbeCounter(ProbeTimeoutCounterOpt(), p.metricLabels())
+	select {
+	case <-done:
+		// the probe has observed the cancellation and reported the result
+	case <-time.After(probeCancelGrace):
+		err := probeError(reasonTimeout, fmt.Errorf("%s probe %s timed out after %v", p.Type, p.Name, timeout))
+		log.Errorf("%v", err)
+		recordProbeResult(p.Name, p.Type, timeout, err)
+	}
+}
+
+// scheduleProbe runs the probe at its interval, the first run is immediate if runNow is true
+func scheduleProbe(p *Probe, runNow bool) {
+	getScheduler().Schedule(p, runNow)
+}
+
+// scheduleProbes runs the probes started together, their first runs are staggered or spread across the interval
+func scheduleProbes(list []*Probe) {
+	policy := GetConfig().SchedulerConfig
+	for i, p := range list {
+		getScheduler().ScheduleAfter(p, policy.firstRunOffset(i, len(list), p.Interval))
+	}
+}
+
+// registerProbes registers the probes and returns them
+func registerProbes(list []*Probe) []*Probe {
+	for _, p := range list {
+		registerProbe(p)
+	}
+	return list
+}
+
+// Stop stops the scheduled runs of the probe, a run in progress is completed
+func (p *Probe) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+func (p *Probe) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// withSchedule sets the cron schedule and the active hours of the probe
+// An invalid schedule is logged and ignored, the probe runs at the interval.
+func (p *Probe) withSchedule(c ProbeScheduleCfg) *Probe {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		log.Errorf("%s probe %s schedule is ignored, error %v", p.Type, p.Name, err)
+		return p
+	}
+	if c.Schedule != "" {
+		if p.cron, err = schedule.ParseInLocation(c.Schedule, loc); err != nil {
+			log.Errorf("%s probe %s schedule is ignored, error %v", p.Type, p.Name, err)
+		}
+	}
+	if len(c.ActiveHours) > 0 {
+		if p.activeHours, err = schedule.ParseHoursInLocation(c.ActiveHours, loc); err != nil {
+			log.Errorf("%s probe %s active hours are ignored, error %v", p.Type, p.Name, err)
+		}
+	}
+	return p
+}
+
+// probeFingerprint is a digest of the probe configuration
+func probeFingerprint(v ...interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// the probe is always restarted on reload
+		return fmt.Sprintf("%v", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// reloadableProbes returns the unregistered probes that are reconciled on a configuration reload
+func reloadableProbes() []*Probe {
+	list := topicProbes()
+	list = append(list, webSocketProbes()...)
+	list = append(list, siteProbes()...)
+	return append(list, tenantsProbes()...)
+}
+
+// reconcileProbes replaces the running reloadable probes with the desired ones
+// A new probe is started, a probe with a changed configuration is restarted and a removed probe is stopped.
+// The incident and alert policy state of the components is kept. The probes are identified by type and name,
+// a desired probe with the id of another desired probe is not started.
+func reconcileProbes(desired []*Probe) (started, restarted, stopped []string) {
+	reloadable := make(map[string]bool)
+	for _, t := range []string{ProbeTypePubSub, ProbeTypePartitionTopic, ProbeTypeWebSocket, ProbeTypeSite, ProbeTypeTenants} {
+		reloadable[t] = true
+	}
+
+	desiredIDs := make(map[string]bool)
+	toStart := []*Probe{}
+	stoppedIDs := []string{}
+	probesLock.Lock()
+	for _, p := range desired {
+		if desiredIDs[p.id()] {
+			log.Errorf("%s probe %s is not started, another %s probe has the same name", p.Type, p.Name, p.Type)
+			continue
+		}
+		desiredIDs[p.id()] = true
+		existing, ok := probes[p.id()]
+		if ok && existing.fingerprint == p.fingerprint {
+			continue
+		}
+		if ok {
+			existing.Stop()
+			// the replacement does not overlap the run in progress, i.e. on an exclusive subscription
+			p.previous = existing
+			restarted = append(restarted, p.Name)
+		} else {
+			started = append(started, p.Name)
+		}
+		p.stop = make(chan struct{})
+		probes[p.id()] = p
+		toStart = append(toStart, p)
+	}
+	for id, p := range probes {
+		if reloadable[p.Type] && !desiredIDs[id] {
+			p.Stop()
+			delete(probes, id)
+			stopped = append(stopped, p.Name)
+			stoppedIDs = append(stoppedIDs, id)
+		}
+	}
+	probesLock.Unlock()
+
+	probeStatusesLock.Lock()
+	for _, id := range stoppedIDs {
+		delete(probeStatuses, id)
+		delete(probeHistory, id)
+	}
+	probeStatusesLock.Unlock()
+	// the anomaly baselines of the removed probes
+	for _, id := range stoppedIDs {
+		util.DeleteDetector(id)
+	}
+
+	scheduleProbes(toStart)
+	sort.Strings(started)
+	sort.Strings(restarted)
+	sort.Strings(stopped)
+	return started, restarted, stopped
+}
+
+// registerConfiguredProbes registers the probes of every configured test without scheduling them
+func registerConfiguredProbes() []*Probe {
+	list := registerProbes(reloadableProbes())
+	list = append(list, registerBrokersProbes()...)
+	k8sProbes, err := registerK8sProbes()
+	if err != nil {
+		// the k8s probe cannot run without a client, it is reported as a failed run
+		name := GetConfig().Name + "-in-cluster"
+		list = append(list, &Probe{Name: name, Type: ProbeTypeK8s, Component: name, run: func(ctx context.Context) {
+			recordProbeResult(name, ProbeTypeK8s, 0, err)
+		}})
+	}
+	return append(list, k8sProbes...)
+}
+
+// RunProbesOnce runs every configured probe a single time in parallel
+// It returns the results sorted by type and name.
+func RunProbesOnce() []ProbeStatus {
+	list := registerConfiguredProbes()
+	sortProbes(list)
+
+	results := make([]ProbeStatus, len(list))
+	var wg sync.WaitGroup
+	for i, p := range list {
+		wg.Add(1)
+		go func(i int, p *Probe) {
+			defer wg.Done()
+			// the probes are new, a run is never in progress
+			results[i], _ = p.Run()
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+// recordProbeResult records the outcome of a probe run, a nil error is a successful run
+func recordProbeResult(name, probeType string, latency time.Duration, err error) ProbeStatus {
+	PromProbeOutcome(name, probeType, err)
+
+	probeStatusesLock.Lock()
+	defer probeStatusesLock.Unlock()
+
+	id := probeID(probeType, name)
+	status := probeStatuses[id]
+	status.Name = name
+	status.Type = probeType
+	status.LastRunAt = time.Now()
+	status.LatencyMs = float64(latency) / float64(time.Millisecond)
+	status.Runs++
+	if err != nil {
+		status.Healthy = false
+		status.Error = err.Error()
+		status.Failures++
+	} else {
+		status.Healthy = true
+		status.Error = ""
+		status.LastSuccessAt = status.LastRunAt
+	}
+	probeStatuses[id] = status
+
+	history := append(probeHistory[id], ProbeSample{
+		At:        status.LastRunAt,
+		Healthy:   status.Healthy,
+		LatencyMs: status.LatencyMs,
+	})
+	if len(history) > probeHistorySize {
+		history = history[len(history)-probeHistorySize:]
+	}
+	probeHistory[id] = history
+	return status
+}
+
+func getProbeStatus(probeType, name string) ProbeStatus {
+	probeStatusesLock.RLock()
+	defer probeStatusesLock.RUnlock()
+	return probeStatuses[probeID(probeType, name)]
+}
+
+// getProbeHistory returns a copy of the recent samples of a probe
+func getProbeHistory(probeType, name string) []ProbeSample {
+	probeStatusesLock.RLock()
+	defer probeStatusesLock.RUnlock()
+	return append([]ProbeSample{}, probeHistory[probeID(probeType, name)]...)
+}
+
+// GetProbeStatuses returns the last result of every probe sorted by name and type
+func GetProbeStatuses() []ProbeStatus {
+	probeStatusesLock.RLock()
+	list := make([]ProbeStatus, 0, len(probeStatuses))
+	for _, v := range probeStatuses {
+		list = append(list, v)
+	}
+	probeStatusesLock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Type < list[j].Type
+	})
+	return list
+}
@@ -0,0 +1,101 @@
+package cfg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
+)
+
+func TestRunProbesOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/up" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	saved := GetConfig()
+	defer setConfig(saved)
+	setConfig(&Configuration{
+		Name: "once",
+		SitesConfig: SitesCfg{Sites: []SiteCfg{
+			{Name: "once-up", URL: server.URL + "/up", StatusCode: http.StatusOK},
+			{Name: "once-down", URL: server.URL + "/down", StatusCode: http.StatusOK},
+		}},
+	})
+
+	results := RunProbesOnce()
+	assert(t, 2 == len(results), "every configured probe runs, %d", len(results))
+	assert(t, "once-down" == results[0].Name && !results[0].Healthy && "" != results[0].Error, "failed probe")
+	assert(t, "once-up" == results[1].Name && results[1].Healthy, "healthy probe")
+	assert(t, 1 == results[1].Runs, "probe runs once")
+}
+
+func TestProbeRunTrace(t *testing.T) {
+	var lock sync.Mutex
+	var traceParent string
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		traceParent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer site.Close()
+
+	type span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Status       struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"status"`
+	}
+	var spans []span
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			return
+		}
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		errNil(t, json.NewDecoder(r.Body).Decode(&req))
+		spans = append(spans, req.ResourceSpans[0].ScopeSpans[0].Spans...)
+	}))
+	defer collector.Close()
+
+	saved := GetConfig()
+	defer setConfig(saved)
+	setConfig(&Configuration{
+		Name:        "traced",
+		SitesConfig: SitesCfg{Sites: []SiteCfg{{Name: "traced-site", URL: site.URL, StatusCode: http.StatusOK}}},
+	})
+	exporter := otlp.NewExporter(otlp.Config{Endpoint: collector.URL})
+	otlp.SetExporter(exporter)
+	defer otlp.SetExporter(nil)
+
+	results := RunProbesOnce()
+	assert(t, 1 == len(results) && !results[0].Healthy, "failed site probe")
+	// the spans of the last runs are exported on shutdown
+	flushOTLPExport(time.Second)
+
+	assert(t, 3 == len(spans), "the probe run, the site check and the request spans, %d spans", len(spans))
+	request, check, run := spans[0], spans[1], spans[2]
+	assert(t, "site probe" == run.Name && "" == run.ParentSpanID, "the probe run is the root span %+v", run)
+	assert(t, "site check" == check.Name && run.SpanID == check.ParentSpanID, "site check span %+v", check)
+	assert(t, "request" == request.Name && check.SpanID == request.ParentSpanID, "request span %+v", request)
+	assert(t, run.TraceID == check.TraceID && run.TraceID == request.TraceID, "the spans are in the same trace")
+	assert(t, 2 == run.Status.Code && results[0].Error == run.Status.Message, "the failed run is recorded in the root span %+v", run.Status)
+	assert(t, strings.HasPrefix(traceParent, "00-"+run.TraceID+"-"+request.SpanID), "the trace is propagated to the site, %s", traceParent)
+}
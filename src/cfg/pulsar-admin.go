@@ -1,6 +1,7 @@
 package cfg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,7 +16,7 @@ import (
 
 // PulsarAdminTenant probes the tenant endpoint to get a list of tenants
 // returns the number of tenants on the cluster
-func PulsarAdminTenant(clusterURL, token string) (int, error) {
+func PulsarAdminTenant(ctx context.Context, clusterURL, token string) (int, error) {
 
 	client := retryablehttp.NewClient()
 	client.HTTPClient.Timeout = time.Duration(10) * time.Second
@@ -25,8 +26,9 @@ func PulsarAdminTenant(clusterURL, token string) (int, error) {
 
 	req, err := retryablehttp.NewRequest(http.MethodGet, clusterURL, nil)
 	if err != nil {
-		return 0, err
+		return 0, probeError(reasonInvalidConfig, err)
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Add("Authorization", "Bearer "+token)
 
@@ -35,19 +37,19 @@ func PulsarAdminTenant(clusterURL, token string) (int, error) {
 		defer resp.Body.Close()
 	}
 	if err != nil {
-		return 0, err
+		return 0, probeError(reasonConnect, err)
 	}
 
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return 0, err
+		return 0, probeError(reasonReceive, err)
 	}
 
 	var tenants []string
 
 	err = json.Unmarshal(bodyBytes, &tenants)
 	if err != nil {
-		return 0, err
+		return 0, probeError(reasonInvalidResponse, err)
 	}
 
 	return len(tenants), nil
@@ -55,29 +57,62 @@ func PulsarAdminTenant(clusterURL, token string) (int, error) {
 
 // PulsarTenants get a list of tenants on each cluster
 func PulsarTenants() {
-	clusters := GetConfig().PulsarAdminConfig.Clusters
-	token := util.AssignString(GetConfig().PulsarAdminConfig.Token, GetConfig().Token)
+	for _, cluster := range GetConfig().PulsarAdminConfig.Clusters {
+		testTenants(context.Background(), cluster)
+	}
+}
 
-	for _, cluster := range clusters {
-		adminURL, err := url.ParseRequestURI(cluster.URL)
-		if err != nil {
-			panic(err) //panic because this is a showstopper
-		}
-		clusterName := adminURL.Hostname()
-		queryURL := util.SingleSlashJoin(cluster.URL, "/admin/v2/tenants")
-		tenantSize, err := PulsarAdminTenant(queryURL, token)
-		if err != nil {
-			errMsg := fmt.Sprintf("tenant-test failed on cluster %s error: %v", queryURL, err)
-			VerboseAlert(clusterName+"-pulsar-admin", errMsg, 3*time.Minute)
-			ReportIncident(cluster.Name, clusterName, "persisted cluster tenants test failure", errMsg, &cluster.AlertPolicy)
+// MonitorTenants starts the tenants test of each cluster
+func MonitorTenants() {
+	scheduleProbes(registerProbes(tenantsProbes()))
+}
+
+// tenantsProbes returns the unregistered tenants probes of the configured clusters
+func tenantsProbes() []*Probe {
+	list := []*Probe{}
+	interval := util.TimeDuration(GetConfig().PulsarAdminConfig.IntervalSeconds, 120, time.Second)
+	timeout := time.Duration(GetConfig().PulsarAdminConfig.TimeoutSeconds) * time.Second
+	for _, cluster := range GetConfig().PulsarAdminConfig.Clusters {
+		c := cluster
+		list = append(list, &Probe{
+			Name:        c.Name,
+			Type:        ProbeTypeTenants,
+			Component:   c.Name,
+			Interval:    interval,
+			Timeout:     timeout,
+			fingerprint: probeFingerprint(c, interval, timeout),
+			run:         func(ctx context.Context) { testTenants(ctx, c) },
+		})
+	}
+	return list
+}
+
+func testTenants(ctx context.Context, cluster OpsClusterCfg) {
+	token := util.AssignString(GetConfig().PulsarAdminConfig.Token, GetConfig().Token)
+	adminURL, err := url.ParseRequestURI(cluster.URL)
+	if err != nil {
+		log.Printf("tenants test of cluster %s has an invalid url %s, error %v", cluster.Name, cluster.URL, err)
+		recordProbeResult(cluster.Name, ProbeTypeTenants, 0, probeError(reasonInvalidConfig, err))
+		return
+	}
+	clusterName := adminURL.Hostname()
+	registerProbeComponent(cluster.Name, clusterName, ProbeTypeTenants)
+	registerProbeComponent(clusterName+"-pulsar-admin", clusterName, ProbeTypeTenants)
+	queryURL := util.SingleSlashJoin(cluster.URL, "/admin/v2/tenants")
+	start := time.Now()
+	tenantSize, err := PulsarAdminTenant(ctx, queryURL, token)
+	recordProbeResult(cluster.Name, ProbeTypeTenants, time.Since(start), err)
+	if err != nil {
+		errMsg := fmt.Sprintf("tenant-test failed on cluster %s error: %v", queryURL, err)
+		VerboseAlert(clusterName+"-pulsar-admin", errMsg, 3*time.Minute)
+		ReportIncident(cluster.Name, clusterName, "persisted cluster tenants test failure", errMsg, &cluster.AlertPolicy)
+	} else {
+		PromGaugeInt(TenantsGaugeOpt(), cluster.Name, tenantSize)
+		ClearIncident(cluster.Name)
+		if tenantSize == 0 {
+			VerboseAlert(clusterName+"-pulsar-admin", fmt.Sprintf("%s has incorrect number of tenants 0", cluster.Name), 3*time.Minute)
 		} else {
-			PromGaugeInt(TenantsGaugeOpt(), cluster.Name, tenantSize)
-			ClearIncident(cluster.Name)
-			if tenantSize == 0 {
-				VerboseAlert(clusterName+"-pulsar-admin", fmt.Sprintf("%s has incorrect number of tenants 0", cluster.Name), 3*time.Minute)
-			} else {
-				log.Printf("cluster %s has %d numbers of tenants", clusterName, tenantSize)
-			}
+			log.Printf("cluster %s has %d numbers of tenants", clusterName, tenantSize)
 		}
 	}
 }
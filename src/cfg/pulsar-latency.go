@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
 	log "github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
 	"github.com/kafkaesque-io/pulsar-monitor/src/topic"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 )
@@ -18,11 +21,16 @@ import (
 const (
 	latencyBudget = 2400 // in Millisecond integer, will convert to time.Duration in evaluation
 	failedLatency = 100 * time.Second
+
+	partitionTestName       = "partition-topics-test"
+	partitionTopicSubsystem = "partition_topic"
 )
 
 var (
 	clients         = make(map[string]pulsar.Client)
 	partitionTopics = make(map[string]*topic.PartitionTopics)
+	// guards clients and partitionTopics
+	clientsLock = &sync.Mutex{}
 )
 
 // MsgResult stores the result of message test
@@ -30,11 +38,93 @@ type MsgResult struct {
 	InOrderDelivery bool
 	Latency         time.Duration
 	SentTime        time.Time
+	Stages          StageLatency
+	// MessageLatencies are the latencies of the messages in the order of receipt, Latency is their mean
+	MessageLatencies []time.Duration
+	Percentiles      LatencyPercentiles
+}
+
+// LatencyPercentiles summarizes the message latencies of a test to expose the tail latency
+type LatencyPercentiles struct {
+	Min time.Duration
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// the percentile label values of the message latency metrics and the latency budget percentiles besides the mean
+var percentileNames = []string{"min", "p50", "p95", "p99", "max"}
+
+const meanLatency = "mean"
+
+func (p LatencyPercentiles) durations() []time.Duration {
+	return []time.Duration{p.Min, p.P50, p.P95, p.P99, p.Max}
+}
+
+// latencyPercentiles returns the nearest rank percentiles of the latencies
+func latencyPercentiles(latencies []time.Duration) LatencyPercentiles {
+	if len(latencies) == 0 {
+		return LatencyPercentiles{}
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(percentile float64) time.Duration {
+		i := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+		return sorted[util.MaxInt(i, 0)]
+	}
+	return LatencyPercentiles{
+		Min: sorted[0],
+		P50: rank(50),
+		P95: rank(95),
+		P99: rank(99),
+		Max: sorted[len(sorted)-1],
+	}
+}
+
+// budgetLatency returns the latency of the percentile compared with the latency budget, the mean by default
+func (r MsgResult) budgetLatency(percentile string) time.Duration {
+	for i, name := range percentileNames {
+		if name == percentile {
+			return r.Percentiles.durations()[i]
+		}
+	}
+	return r.Latency
+}
+
+// StageLatency breaks down the latency of a pubsub test into the lookup, the broker write path and the dispatch
+// A stage is zero if the test failed before it was measured.
+type StageLatency struct {
+	// Connect is the time to get the Pulsar client, it is short for a cached client
+	Connect        time.Duration
+	ProducerCreate time.Duration
+	Subscribe      time.Duration
+	// PublishAck is the average time from the send to the acknowledgement of the broker in the SendAsync callback
+	PublishAck time.Duration
+	// EndToEnd is the average time from the send to the receive
+	EndToEnd time.Duration
+}
+
+// the stage label values of the stage latency metrics, in the order of the test
+var stageNames = []string{"connect", "producer_create", "subscribe", "publish_ack", "end_to_end"}
+
+func (s StageLatency) durations() []time.Duration {
+	return []time.Duration{s.Connect, s.ProducerCreate, s.Subscribe, s.PublishAck, s.EndToEnd}
+}
+
+func (s StageLatency) String() string {
+	parts := []string{}
+	for i, d := range s.durations() {
+		parts = append(parts, fmt.Sprintf("%s %v", stageNames[i], d))
+	}
+	return strings.Join(parts, ", ")
 }
 
 // GetPulsarClient gets the pulsar client object
 // Note: the caller has to Close() the client object
 func GetPulsarClient(pulsarURL, tokenStr string) (pulsar.Client, error) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
 	client, ok := clients[pulsarURL]
 	if !ok {
 		clientOpt := pulsar.ClientOptions{
@@ -65,26 +155,72 @@ func GetPulsarClient(pulsarURL, tokenStr string) (pulsar.Client, error) {
 	return client, nil
 }
 
+// evictPulsarClient removes a broken client from the cache, the caller closes the client
+func evictPulsarClient(pulsarURL string) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	delete(clients, pulsarURL)
+}
+
+// CloseClients closes the cached Pulsar clients
+func CloseClients() {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	for url, client := range clients {
+		client.Close()
+		delete(clients, url)
+	}
+	partitionTopics = make(map[string]*topic.PartitionTopics)
+}
+
 // PubSubLatency the latency including successful produce and consume of a message
-func PubSubLatency(clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix, expectedSuffix string, payloads [][]byte, maxPayloadSize int) (MsgResult, error) {
+// It waits for the messages until the context is done, 5 seconds per message if the context has no deadline.
+// The run is traced with the spans of the connect, producer create, subscribe and every message send, receive and ack.
+// The result has the latency of every stage measured before a failure.
+func PubSubLatency(ctx context.Context, clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix, expectedSuffix string, payloads [][]byte, maxPayloadSize int) (result MsgResult, err error) {
+	ctx, cancel := util.WithDefaultTimeout(ctx, time.Duration(5*len(payloads))*time.Second)
+	defer cancel()
+	ctx, span := otlp.Start(ctx, "pubsub latency", otlp.String("pulsar.topic", topicName), otlp.Int("messages", len(payloads)))
+
+	// the publish ack latency is updated by the SendAsync callbacks
+	var stages StageLatency
+	var ackTotal time.Duration
+	ackCount := 0
+	stagesLock := &sync.Mutex{}
+	defer func() {
+		stagesLock.Lock()
+		result.Stages = stages
+		stagesLock.Unlock()
+		if err == nil {
+			result.Stages.EndToEnd = result.Latency
+		}
+		span.EndWithError(err)
+	}()
+
+	_, connectSpan := otlp.Start(ctx, "connect", otlp.String("pulsar.url", uri))
 	client, err := GetPulsarClient(uri, tokenStr)
+	connectSpan.EndWithError(err)
+	stages.Connect = connectSpan.Duration()
 	if err != nil {
-		return MsgResult{Latency: failedLatency}, err
+		return MsgResult{Latency: failedLatency}, probeError(reasonConnect, err)
 	}
 
 	// it is important to close client after close of producer/consumer
 	// defer client.Close()
 
 	// Use the client to instantiate a producer
+	_, producerSpan := otlp.Start(ctx, "producer create")
 	producer, err := client.CreateProducer(pulsar.ProducerOptions{
 		Topic: topicName,
 	})
+	producerSpan.EndWithError(err)
+	stages.ProducerCreate = producerSpan.Duration()
 
 	if err != nil {
 		// we guess something could have gone wrong if producer cannot be created
 		client.Close()
-		delete(clients, uri)
-		return MsgResult{Latency: failedLatency}, err
+		evictPulsarClient(uri)
+		return MsgResult{Latency: failedLatency}, probeError(reasonProducerCreate, err)
 	}
 
 	defer producer.Close()
@@ -94,17 +230,20 @@ func PubSubLatency(clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix
 	// use the same input topic if outputTopic does not exist
 	// Two topic use case could be for Pulsar function test
 	consumerTopic := util.AssignString(outputTopic, topicName)
+	_, subscribeSpan := otlp.Start(ctx, "subscribe", otlp.String("pulsar.topic", consumerTopic))
 	consumer, err := client.Subscribe(pulsar.ConsumerOptions{
 		Topic:                       consumerTopic,
 		SubscriptionName:            subscriptionName,
 		Type:                        pulsar.Exclusive,
 		SubscriptionInitialPosition: pulsar.SubscriptionPositionLatest,
 	})
+	subscribeSpan.EndWithError(err)
+	stages.Subscribe = subscribeSpan.Duration()
 
 	if err != nil {
 		defer client.Close() //must defer to allow producer to be closed first
-		delete(clients, uri)
-		return MsgResult{Latency: failedLatency}, err
+		evictPulsarClient(uri)
+		return MsgResult{Latency: failedLatency}, probeError(reasonSubscribe, err)
 	}
 	defer consumer.Close()
 
@@ -127,15 +266,22 @@ func PubSubLatency(clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix
 	go func() {
 
 		lastMessageIndex := -1 // to track the message delivery order
+		latencies := make([]time.Duration, 0, len(payloads))
 		for receivedCount > 0 {
-			cCtx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+			cCtx, cancel := context.WithTimeout(ctx, receiveTimeout)
 			defer cancel()
 
 			log.Infof("wait to receive on message count %d", receivedCount)
+			_, receiveSpan := otlp.Start(ctx, "receive")
 			msg, err := consumer.Receive(cCtx)
+			receiveSpan.EndWithError(err)
 			if err != nil {
 				receivedCount = 0 // play safe?
-				errorChan <- fmt.Errorf("consumer Receive() error: %v", err)
+				reason := reasonReceive
+				if cCtx.Err() != nil {
+					reason = reasonReceiveTimeout
+				}
+				errorChan <- probeError(reason, fmt.Errorf("consumer Receive() error: %v", err))
 				break
 			}
 			receivedTime := time.Now()
@@ -148,12 +294,15 @@ func PubSubLatency(clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix
 			if ok {
 				receivedCount--
 				result.Latency = receivedTime.Sub(result.SentTime)
+				latencies = append(latencies, result.Latency)
 				if currentMsgIndex > lastMessageIndex {
 					result.InOrderDelivery = true
 					lastMessageIndex = currentMsgIndex
 				}
 			}
+			_, ackSpan := otlp.Start(ctx, "ack")
 			consumer.Ack(msg)
+			ackSpan.End()
 			log.Infof("consumer received message index %d payload size %d\n", currentMsgIndex, len(receivedStr))
 		}
 
@@ -168,19 +317,22 @@ func PubSubLatency(clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix
 
 			// receiverLatency <- total / receivedCount
 			completeChan <- MsgResult{
-				Latency:         time.Duration(int(total/time.Millisecond)/len(payloads)) * time.Millisecond,
-				InOrderDelivery: inOrder,
+				Latency:          time.Duration(int(total/time.Millisecond)/len(payloads)) * time.Millisecond,
+				InOrderDelivery:  inOrder,
+				MessageLatencies: latencies,
+				Percentiles:      latencyPercentiles(latencies),
 			}
 		}
 
 	}()
 
 	for _, payload := range payloads {
-		ctx := context.Background()
-
 		// Create a different message to send asynchronously
+		// the traceparent property correlates the message with the broker and the consumer side traces
+		_, sendSpan := otlp.Start(ctx, "send", otlp.Int("message.size", len(payload)))
 		asyncMsg := pulsar.ProducerMessage{
-			Payload: payload,
+			Payload:    payload,
+			Properties: map[string]string{"traceparent": sendSpan.TraceParent()},
 		}
 
 		sentTime := time.Now()
@@ -190,11 +342,19 @@ func PubSubLatency(clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix
 		mapMutex.Unlock()
 		// Attempt to send message asynchronously and handle the response
 		producer.SendAsync(ctx, &asyncMsg, func(messageId pulsar.MessageID, msg *pulsar.ProducerMessage, err error) {
+			sendSpan.EndWithError(err)
+			if err == nil {
+				stagesLock.Lock()
+				ackTotal += time.Since(sentTime)
+				ackCount++
+				stages.PublishAck = ackTotal / time.Duration(ackCount)
+				stagesLock.Unlock()
+			}
 			if err != nil {
 				errMsg := fmt.Sprintf("fail to instantiate Pulsar client: %v", err)
 				log.Infof(errMsg)
 				// report error and exit
-				errorChan <- errors.New(errMsg)
+				errorChan <- probeError(reasonSend, errors.New(errMsg))
 			}
 
 			log.Infof("successfully published %v", sentTime)
@@ -202,66 +362,120 @@ func PubSubLatency(clusterName, tokenStr, uri, topicName, outputTopic, msgPrefix
 		})
 	}
 
-	ticker := time.NewTicker(time.Duration(5*len(payloads)) * time.Second)
-	defer ticker.Stop()
 	select {
 	case receiverLatency := <-completeChan:
 		return receiverLatency, nil
 	case reportedErr := <-errorChan:
 		log.Infof("received error %v", reportedErr)
 		return MsgResult{Latency: failedLatency}, reportedErr
-	case <-ticker.C:
-		return MsgResult{Latency: failedLatency}, errors.New("latency measure not received after timeout")
+	case <-ctx.Done():
+		return MsgResult{Latency: failedLatency}, probeError(reasonReceiveTimeout, errors.New("latency measure not received after timeout"))
 	}
 }
 
 // TopicLatencyTestThread tests a message delivery in topic and measure the latency.
 func TopicLatencyTestThread() {
-	topics := GetConfig().PulsarTopicConfig
-	log.Infof("topic configuration %v", topics)
-
-	for _, topic := range topics {
-		go func(t TopicCfg) {
-			ticker := time.NewTicker(util.TimeDuration(t.IntervalSeconds, 60, time.Second))
-			TestTopicLatency(t)
-			for {
-				select {
-				case <-ticker.C:
-					TestTopicLatency(t)
-				}
-			}
-		}(topic)
+	log.Infof("topic configuration %v", GetConfig().PulsarTopicConfig)
+	scheduleProbes(registerProbes(topicProbes()))
+}
+
+// topicProbes returns the unregistered probes of the configured topics
+func topicProbes() []*Probe {
+	list := []*Probe{}
+	for _, topic := range GetConfig().PulsarTopicConfig {
+		t := topic
+		p := &Probe{
+			Name:        topicProbeName(t),
+			Type:        topicProbeType(t),
+			Component:   topicComponent(t),
+			Interval:    util.TimeDuration(t.IntervalSeconds, 60, time.Second),
+			Timeout:     time.Duration(t.TimeoutSeconds) * time.Second,
+			fingerprint: probeFingerprint(t),
+			run:         func(ctx context.Context) { TestTopicLatency(ctx, t) },
+		}
+		list = append(list, p.withSchedule(t.ProbeScheduleCfg))
+	}
+	return list
+}
+
+// topicProbeName is the configured name or the incident component name of the topic test
+func topicProbeName(topicCfg TopicCfg) string {
+	return util.AssignString(topicCfg.Name, topicComponent(topicCfg))
+}
+
+// topicComponent is the incident component name of the topic test
+func topicComponent(topicCfg TopicCfg) string {
+	clusterName := topicCfg.PulsarURL
+	if adminURL, err := url.ParseRequestURI(topicCfg.PulsarURL); err == nil {
+		clusterName = adminURL.Hostname()
+	}
+	if topicCfg.NumberOfPartitions < 2 {
+		return clusterName
+	}
+	return clusterName + "-" + partitionTestName
+}
+
+// topicProbeLabels are the metric labels of the topic test
+func topicProbeLabels(clusterName string, topicCfg TopicCfg) ProbeLabels {
+	return ProbeLabels{
+		Device:    clusterName,
+		Probe:     topicProbeName(topicCfg),
+		Type:      topicProbeType(topicCfg),
+		Topic:     topicCfg.TopicName,
+		SizeClass: payloadSizeClass(topicCfg.PayloadSizes),
+	}
+}
+
+func topicProbeType(topicCfg TopicCfg) string {
+	if topicCfg.NumberOfPartitions < 2 {
+		return ProbeTypePubSub
 	}
+	return ProbeTypePartitionTopic
 }
 
 // TestTopicLatency test generic message delivery in topics and the latency
-func TestTopicLatency(topicCfg TopicCfg) {
+// The run is cancelled when the context is done.
+func TestTopicLatency(ctx context.Context, topicCfg TopicCfg) {
 	// uri is in the form of pulsar+ssl://fqdn:6651
 	adminURL, err := url.ParseRequestURI(topicCfg.PulsarURL)
 	if err != nil {
-		panic(err) //panic because this is a showstopper
+		log.Errorf("topic test %s has an invalid pulsarUrl %s, error %v", topicProbeName(topicCfg), topicCfg.PulsarURL, err)
+		recordProbeResult(topicProbeName(topicCfg), topicProbeType(topicCfg), 0, probeError(reasonInvalidConfig, err))
+		return
 	}
 	clusterName := adminURL.Hostname()
 	token := util.AssignString(topicCfg.Token, GetConfig().Token)
 
 	if topicCfg.NumberOfPartitions < 2 {
-		testTopicLatency(clusterName, token, topicCfg)
+		testTopicLatency(ctx, clusterName, token, topicCfg)
 	} else {
-		testPartitionTopic(clusterName, token, topicCfg)
+		testPartitionTopic(ctx, clusterName, token, topicCfg)
 	}
 }
 
-func testTopicLatency(clusterName, token string, topicCfg TopicCfg) {
-	stdVerdict := util.GetStdBucket(clusterName)
+func testTopicLatency(ctx context.Context, clusterName, token string, topicCfg TopicCfg) {
 	expectedLatency := util.TimeDuration(topicCfg.LatencyBudgetMs, latencyBudget, time.Millisecond)
 	prefix := "messageid"
 	payloads, maxPayloadSize := AllMsgPayloads(prefix, topicCfg.PayloadSizes, topicCfg.NumOfMessages)
 	log.Infof("send %d messages to topic %s on cluster %s with latency budget %v, %v, %d",
 		len(payloads), topicCfg.TopicName, topicCfg.PulsarURL, expectedLatency, topicCfg.PayloadSizes, topicCfg.NumOfMessages)
-	result, err := PubSubLatency(clusterName, token, topicCfg.PulsarURL, topicCfg.TopicName, topicCfg.OutputTopic, prefix, topicCfg.ExpectedMsg, payloads, maxPayloadSize)
+	// the messages are expected within 5 seconds each unless the timeout is configured
+	ctx, cancel := context.WithTimeout(ctx, util.TimeDuration(topicCfg.TimeoutSeconds, 5*len(payloads), time.Second))
+	defer cancel()
+	result, err := PubSubLatency(ctx, clusterName, token, topicCfg.PulsarURL, topicCfg.TopicName, topicCfg.OutputTopic, prefix, topicCfg.ExpectedMsg, payloads, maxPayloadSize)
+	reportTopicLatency(ctx, clusterName, topicCfg, result, err)
+}
 
+// reportTopicLatency evaluates the result of a pubsub test, alerts and records the probe run
+func reportTopicLatency(ctx context.Context, clusterName string, topicCfg TopicCfg, result MsgResult, err error) {
+	detectorKey := probeID(ProbeTypePubSub, topicProbeName(topicCfg))
+	expectedLatency := util.TimeDuration(topicCfg.LatencyBudgetMs, latencyBudget, time.Millisecond)
 	testName := util.AssignString(topicCfg.Name, pubSubSubsystem)
-	log.Infof("cluster %s has message latency %v", clusterName, result.Latency)
+	registerProbeComponent(clusterName, clusterName, ProbeTypePubSub)
+	log.Infof("cluster %s has message latency %v, stages %v", clusterName, result.Latency, result.Stages)
+	// the anomaly detector evaluates the same latency as the budget
+	budgetLatency := result.budgetLatency(topicCfg.LatencyBudgetPercentile)
+	probeErr := err
 	if err != nil {
 		errMsg := fmt.Sprintf("cluster %s, %s latency test Pulsar error: %v", clusterName, testName, err)
 		VerboseAlert(clusterName+"-latency-err", errMsg, 3*time.Minute)
@@ -269,35 +483,37 @@ func testTopicLatency(clusterName, token string, topicCfg TopicCfg) {
 		AnalyticsLatencyReport(clusterName, testName, err.Error(), -1, false, false)
 	} else if !result.InOrderDelivery {
 		errMsg := fmt.Sprintf("cluster %s, %s test Pulsar message received out of order", clusterName, testName)
+		probeErr = probeError(reasonOutOfOrder, errors.New(errMsg))
 		AnalyticsLatencyReport(clusterName, testName, "message delivery out of order", int(result.Latency.Milliseconds()), false, true)
 		VerboseAlert(clusterName+"-latency-outoforder", errMsg, 3*time.Minute)
-	} else if result.Latency > expectedLatency {
-		stdVerdict.Add(float64(result.Latency.Microseconds()))
-		errMsg := fmt.Sprintf("cluster %s, %s test message latency %v over the budget %v",
-			clusterName, testName, result.Latency, expectedLatency)
+	} else if budgetLatency > expectedLatency {
+		addLatency(detectorKey, topicCfg.AnomalyDetector, topicCfg.Timezone, budgetLatency)
+		errMsg := fmt.Sprintf("cluster %s, %s test message %s latency %v over the budget %v",
+			clusterName, testName, util.AssignString(topicCfg.LatencyBudgetPercentile, meanLatency), budgetLatency, expectedLatency)
+		probeErr = probeError(reasonOverBudget, errors.New(errMsg))
 		AnalyticsLatencyReport(clusterName, testName, "", int(result.Latency.Milliseconds()), true, false)
 		VerboseAlert(clusterName+"-latency", errMsg, 3*time.Minute)
 		ReportIncident(clusterName, clusterName, "persisted latency test failure", errMsg, &topicCfg.AlertPolicy)
-	} else if stddev, mean, within6Sigma := stdVerdict.Push(float64(result.Latency.Microseconds())); !within6Sigma && stddev > 0 && mean > 0 {
-		errMsg := fmt.Sprintf("cluster %s, %s test message latency %v μs over six standard deviation %v μs and mean is %v μs",
-			clusterName, testName, result.Latency.Microseconds(), stddev, mean)
-		// 5 ms = 5,000 μs
-		if mean > 5000 {
-			errMsg = fmt.Sprintf("cluster %s, %s test message latency %v over six standard deviation %v ms and mean is %v ms",
-				clusterName, testName, result.Latency, float64(stddev/1000.0), float64(mean/1000.0))
-		}
+	} else if anomaly := latencyAnomaly(detectorKey, topicCfg.AnomalyDetector, topicCfg.Timezone, budgetLatency); anomaly != nil {
+		errMsg := fmt.Sprintf("cluster %s, %s test message %v", clusterName, testName, anomaly)
+		probeErr = probeError(reasonStddevAnomaly, errors.New(errMsg))
 		AnalyticsLatencyReport(clusterName, testName, "", int(result.Latency.Milliseconds()), true, false)
-		VerboseAlert(clusterName+"-latency-stddev", errMsg, 10*time.Minute)
-		// standard deviation does not generate alerts
+		VerboseAlert(clusterName+"-latency-anomaly", errMsg, 10*time.Minute)
+		// latency anomaly does not generate alerts
 		// ReportIncident(clusterName, clusterName, "persisted latency test failure", errMsg, &topicCfg.AlertPolicy)
 	} else {
 		log.Infof("succeeded to sent %d messages to topic %s on %s test cluster %s",
-			len(payloads), topicCfg.TopicName, testName, topicCfg.PulsarURL)
+			len(result.MessageLatencies), topicCfg.TopicName, testName, topicCfg.PulsarURL)
 		AnalyticsLatencyReport(clusterName, testName, "", int(result.Latency.Milliseconds()), true, true)
 		ClearIncident(clusterName)
 	}
+	recordProbeResult(topicProbeName(topicCfg), ProbeTypePubSub, result.Latency, probeErr)
 	if result.Latency < failedLatency {
-		PromLatencySum(GetGaugeType(topicCfg.Name), clusterName, result.Latency)
+		PromProbeLatency(ctx, GetGaugeType(topicCfg.Name), topicProbeLabels(clusterName, topicCfg), result.Latency)
+	}
+	PromStageLatency(ctx, topicProbeLabels(clusterName, topicCfg), result.Stages)
+	if len(result.MessageLatencies) > 0 {
+		PromLatencyPercentiles(topicProbeLabels(clusterName, topicCfg), result.Percentiles)
 	}
 }
 
@@ -308,26 +524,44 @@ func expectedMessage(payload, expected string) string {
 	return payload
 }
 
-func testPartitionTopic(clusterName, token string, cfg TopicCfg) {
+func testPartitionTopic(ctx context.Context, clusterName, token string, cfg TopicCfg) {
 	trustStore := util.AssignString(cfg.TrustStore, GetConfig().TrustStore, "/etc/ssl/certs/ca-bundle.crt")
-	testName := "partition-topics-test"
+	testName := partitionTestName
 	component := clusterName + "-" + testName
+	registerProbeComponent(component, clusterName, ProbeTypePartitionTopic)
+	var latency time.Duration
+	var probeErr error
+	defer func() {
+		recordProbeResult(topicProbeName(cfg), ProbeTypePartitionTopic, latency, probeErr)
+	}()
+
 	pt, err := getPartition(cfg, token, trustStore)
 	if err != nil {
+		probeErr = probeError(reasonConnect, err)
 		errMsg := fmt.Sprintf("%s failed to create PartitionTopic test object, error: %v", component, err)
 		ReportIncident(component, component, "persisted failure to create partition topic test client", errMsg, &cfg.AlertPolicy)
 		return
 	}
+	_, connectSpan := otlp.Start(ctx, "connect", otlp.String("pulsar.url", cfg.PulsarURL))
 	pulsarClient, err := GetPulsarClient(cfg.PulsarURL, token)
+	connectSpan.EndWithError(err)
 	if err != nil {
+		probeErr = probeError(reasonConnect, err)
 		errMsg := fmt.Sprintf("cluster %s, %s failed create Pulsar Client with error: %v", component, testName, err)
 		Alert(errMsg)
 		ReportIncident(component, component, "partition topic test failure", errMsg, &cfg.AlertPolicy)
 		return
 	}
 
-	latency, err := pt.TestPartitionTopic(pulsarClient)
+	// the messages are expected within 60 seconds unless the timeout is configured
+	ctx, cancel := context.WithTimeout(ctx, util.TimeDuration(cfg.TimeoutSeconds, 60, time.Second))
+	defer cancel()
+	latency, err = pt.TestPartitionTopic(ctx, pulsarClient)
 	if err != nil {
+		probeErr = probeError(reasonReceive, err)
+		if ctx.Err() != nil {
+			probeErr = probeError(reasonReceiveTimeout, err)
+		}
 		errMsg := fmt.Sprintf("cluster %s, %s partition topic test failed with Pulsar error: %v", component, testName, err)
 		Alert(errMsg)
 		ReportIncident(component, component, "partition topic test failure", errMsg, &cfg.AlertPolicy)
@@ -337,24 +571,30 @@ func testPartitionTopic(clusterName, token string, cfg TopicCfg) {
 	if latency > expectedLatency || latency == 0 {
 		errMsg := fmt.Sprintf("cluster %s, partition topic test message latency %v over the budget %v",
 			component, latency, expectedLatency)
+		probeErr = probeError(reasonOverBudget, errors.New(errMsg))
 		Alert(errMsg)
 		ReportIncident(component, component, "partition topic test has over budget latency", errMsg, &cfg.AlertPolicy)
 	} else {
 		log.Infof("%d partition topics test successfully passed with latency %v", pt.NumberOfPartitions, latency)
+		PromProbeLatency(ctx, MsgLatencyGaugeOpt(partitionTopicSubsystem, "Pulsar partition topic message latency in ms"),
+			topicProbeLabels(clusterName, cfg), latency)
 		ClearIncident(component)
 	}
 }
 
 func getPartition(cfg TopicCfg, token, trustStore string) (*topic.PartitionTopics, error) {
+	clientsLock.Lock()
 	pt, ok := partitionTopics[cfg.TopicName]
 	if !ok {
 		var err error
 		pt, err = topic.NewPartitionTopic(cfg.PulsarURL, token, trustStore, cfg.TopicName, cfg.AdminURL, cfg.NumberOfPartitions)
 		if err != nil {
+			clientsLock.Unlock()
 			return nil, err
 		}
 		partitionTopics[cfg.TopicName] = pt
 	}
+	clientsLock.Unlock()
 
 	return pt, pt.VerifyPartitionTopic()
 }
@@ -0,0 +1,95 @@
+package cfg
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// reload the configuration file on change or on demand without restarting the process
+
+var reloadLock = &sync.Mutex{}
+
+// ReloadConfigFile re-reads the configuration file and reconciles the running probes
+// The topic, websocket, site and tenants probes are reconciled, the alert sinks are set up again.
+// The current configuration stays in effect if the new one is invalid.
+func ReloadConfigFile(configFile string) error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	previous := GetConfig()
+	if err := ReadConfigFile(configFile); err != nil {
+		log.Errorf("failed to reload configuration file %s, the current configuration stays in effect\n%v", configFile, err)
+		return err
+	}
+	current := GetConfig()
+
+	SetupAlertSinks()
+	started, restarted, stopped := reconcileProbes(reloadableProbes())
+	log.Infof("configuration file %s reloaded, probes started %v, restarted %v, stopped %v", configFile, started, restarted, stopped)
+
+	if changes := restartRequiredChanges(previous, current); len(changes) > 0 {
+		log.Warnf("changes of %s require a restart to take effect", strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+// restartRequiredChanges returns the changed settings that are only applied on startup
+// The static metric labels are set on the metrics when they are registered, the existing metrics keep the previous labels.
+func restartRequiredChanges(previous, current *Configuration) []string {
+	changes := []string{}
+	prevProm, curProm := previous.PrometheusConfig, current.PrometheusConfig
+	if (len(prevProm.Labels) > 0 || len(curProm.Labels) > 0) && !reflect.DeepEqual(prevProm.Labels, curProm.Labels) {
+		changes = append(changes, "prometheusConfig.labels")
+	}
+	prevProm.Labels, curProm.Labels = nil, nil
+	if !reflect.DeepEqual(prevProm, curProm) {
+		changes = append(changes, "prometheusConfig")
+	}
+	if !reflect.DeepEqual(previous.K8sConfig, current.K8sConfig) {
+		changes = append(changes, "k8sConfig")
+	}
+	if !reflect.DeepEqual(previous.BrokersConfig, current.BrokersConfig) {
+		changes = append(changes, "brokersConfig")
+	}
+	if !reflect.DeepEqual(previous.AnalyticsConfig, current.AnalyticsConfig) {
+		changes = append(changes, "analyticsConfig")
+	}
+	return changes
+}
+
+func fileDigest(file string) ([32]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
+
+// WatchConfigFile polls the configuration file and reloads it when the content changes
+// The content is compared since a mounted Kubernetes ConfigMap is updated by replacing a symlink.
+func WatchConfigFile(configFile string, interval time.Duration) {
+	digest, err := fileDigest(configFile)
+	if err != nil {
+		log.Errorf("failed to read configuration file %s to watch, error %v", configFile, err)
+	}
+	getScheduler().Every(interval, false, func() {
+		latest, err := fileDigest(configFile)
+		if err != nil {
+			log.Errorf("failed to read configuration file %s to watch, error %v", configFile, err)
+			return
+		}
+		if latest == digest {
+			return
+		}
+		log.Infof("configuration file %s has changed", configFile)
+		// an invalid file is not retried until it changes again
+		digest = latest
+		ReloadConfigFile(configFile)
+	})
+}
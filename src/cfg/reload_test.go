@@ -0,0 +1,161 @@
+package cfg
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForProbeRuns waits for the runs of a site probe
+func waitForProbeRuns(tb testing.TB, name string, runs int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for getProbeStatus(ProbeTypeSite, name).Runs < runs {
+		assert(tb, time.Now().Before(deadline), "probe %s has not run %d times", name, runs)
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	saved := GetConfig()
+	defer func() {
+		setConfig(saved)
+		reconcileProbes(nil)
+	}()
+
+	siteConfig := func(sites ...string) string {
+		content := "name: reload\nsitesConfig:\n  sites:\n"
+		for _, s := range sites {
+			content += "    - name: " + s + "\n      url: " + server.URL + "/" + s + "\n      intervalSeconds: 3600\n"
+		}
+		return content
+	}
+	file := writeTempConfig(t, "runtime.yml", siteConfig("reload-a", "reload-b"))
+	defer os.RemoveAll(filepath.Dir(file))
+
+	errNil(t, ReloadConfigFile(file))
+	waitForProbeRuns(t, "reload-a", 1)
+	waitForProbeRuns(t, "reload-b", 1)
+	probeA, _ := GetProbe(ProbeTypeSite, "reload-a")
+	probeB, _ := GetProbe(ProbeTypeSite, "reload-b")
+
+	// change b, add c
+	errNil(t, ioutil.WriteFile(file, []byte(strings.Replace(siteConfig("reload-a", "reload-b", "reload-c"), "/reload-b", "/reload-b2", 1)), 0644))
+	errNil(t, ReloadConfigFile(file))
+	waitForProbeRuns(t, "reload-b", 2)
+	waitForProbeRuns(t, "reload-c", 1)
+	p, _ := GetProbe(ProbeTypeSite, "reload-a")
+	assert(t, p == probeA, "unchanged probe keeps running")
+	p, _ = GetProbe(ProbeTypeSite, "reload-b")
+	assert(t, p != probeB, "changed probe is restarted")
+	_, open := <-probeB.stop
+	assert(t, !open, "the replaced probe is stopped")
+	assert(t, 1 == getProbeStatus(ProbeTypeSite, "reload-a").Runs, "unchanged probe is not run again")
+
+	// remove a
+	errNil(t, ioutil.WriteFile(file, []byte(siteConfig("reload-b", "reload-c")), 0644))
+	errNil(t, ReloadConfigFile(file))
+	_, ok := GetProbe(ProbeTypeSite, "reload-a")
+	assert(t, !ok, "removed probe is unregistered")
+	_, open = <-probeA.stop
+	assert(t, !open, "removed probe is stopped")
+
+	// an invalid file does not replace the configuration
+	errNil(t, ioutil.WriteFile(file, []byte("name: reload\nsitesConfig:\n  sites:\n    - name: reload-d\n      url: ftp://host\n"), 0644))
+	assert(t, ReloadConfigFile(file) != nil, "invalid configuration is rejected")
+	assert(t, 2 == len(GetConfig().SitesConfig.Sites), "the current configuration stays in effect")
+	_, ok = GetProbe(ProbeTypeSite, "reload-d")
+	assert(t, !ok, "probes of an invalid configuration are not started")
+}
+
+func TestReconcileDuplicateProbes(t *testing.T) {
+	defer reconcileProbes(nil)
+	desired := func() []*Probe {
+		list := []*Probe{}
+		for i := 0; i < 2; i++ {
+			list = append(list, &Probe{Name: "duplicate-probe", Type: ProbeTypeSite, Interval: time.Hour, fingerprint: strconv.Itoa(i),
+				run: func(ctx context.Context) {}})
+		}
+		return list
+	}
+	first := desired()
+	started, restarted, _ := reconcileProbes(first)
+	assert(t, 1 == len(started) && 0 == len(restarted), "a duplicate probe is not started, started %v", started)
+	p, _ := GetProbe(ProbeTypeSite, "duplicate-probe")
+	assert(t, p == first[0], "the first probe of the name is registered")
+
+	started, restarted, _ = reconcileProbes(desired())
+	assert(t, 0 == len(started) && 0 == len(restarted), "an unchanged configuration does not restart the probes %v %v", started, restarted)
+	p, _ = GetProbe(ProbeTypeSite, "duplicate-probe")
+	assert(t, p == first[0], "the registered probe is kept")
+
+	// the probes of different types have their own identity
+	other := &Probe{Name: "duplicate-probe", Type: ProbeTypeTenants, Interval: time.Hour, run: func(ctx context.Context) {}}
+	started, _, _ = reconcileProbes([]*Probe{first[0], other})
+	tenants, _ := GetProbe(ProbeTypeTenants, "duplicate-probe")
+	p, _ = GetProbe(ProbeTypeSite, "duplicate-probe")
+	assert(t, 1 == len(started) && tenants == other && p == first[0], "a probe of another type with the name is started")
+}
+
+func TestReconcileWaitsForReplacedRun(t *testing.T) {
+	defer reconcileProbes(nil)
+	saved := probeCancelGrace
+	probeCancelGrace = 10 * time.Millisecond
+	defer func() { probeCancelGrace = saved }()
+
+	release := make(chan struct{})
+	var overlapping, runs int32
+	probe := func(fingerprint string, timeout time.Duration) *Probe {
+		return &Probe{Name: "replaced-probe", Type: ProbeTypePubSub, Interval: time.Hour, Timeout: timeout, fingerprint: fingerprint,
+			run: func(ctx context.Context) {
+				if atomic.AddInt32(&runs, 1) > 1 {
+					atomic.AddInt32(&overlapping, 1)
+				}
+				defer atomic.AddInt32(&runs, -1)
+				<-release
+			}}
+	}
+	old := probe("old", 20*time.Millisecond)
+	registerProbe(old)
+	// the run of the old probe is abandoned after the timeout and does not return
+	go old.Run()
+	time.Sleep(50 * time.Millisecond)
+
+	_, restarted, _ := reconcileProbes([]*Probe{probe("new", 0)})
+	assert(t, 1 == len(restarted), "the changed probe is restarted")
+	replacement, _ := GetProbe(ProbeTypePubSub, "replaced-probe")
+	_, err := replacement.Run()
+	assert(t, errors.Is(err, errProbeRunning), "the replacement does not run while the replaced run is in progress, %v", err)
+	_, err = old.Run()
+	assert(t, errors.Is(err, errProbeStopped), "a replaced probe is not run, %v", err)
+
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	_, err = replacement.Run()
+	errNil(t, err)
+	assert(t, 0 == atomic.LoadInt32(&overlapping), "the runs do not overlap")
+}
+
+func TestRestartRequiredChanges(t *testing.T) {
+	previous := &Configuration{PrometheusConfig: PrometheusCfg{Labels: map[string]string{"region": "us-east-1"}}}
+	current := &Configuration{PrometheusConfig: PrometheusCfg{Labels: map[string]string{"region": "us-west-2"}}}
+	changes := restartRequiredChanges(previous, current)
+	assert(t, 1 == len(changes) && "prometheusConfig.labels" == changes[0], "a change of the static labels requires a restart %v", changes)
+
+	current = &Configuration{PrometheusConfig: PrometheusCfg{Labels: map[string]string{"region": "us-east-1"}, LatencyBucketsMs: []float64{10}}}
+	changes = restartRequiredChanges(previous, current)
+	assert(t, 1 == len(changes) && "prometheusConfig" == changes[0], "the other prometheus settings %v", changes)
+	assert(t, 0 == len(restartRequiredChanges(&Configuration{}, &Configuration{PrometheusConfig: PrometheusCfg{Labels: map[string]string{}}})),
+		"no labels are the same as empty labels")
+}
@@ -0,0 +1,269 @@
+package cfg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/golang/snappy"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	defaultRemoteWriteBatchSize = 500
+	defaultRemoteWriteRetries   = 3
+)
+
+// RemoteWriter writes the metrics of the in-process registry to a Prometheus remote write endpoint
+type RemoteWriter struct {
+	url            string
+	authorization  string
+	batchSize      int
+	externalLabels map[string]string
+	metricPrefixes []string
+	gatherer       prometheus.Gatherer
+	client         *retryablehttp.Client
+}
+
+// remoteLabel and remoteSeries are the prompb.Label and the prompb.TimeSeries with a single sample
+type remoteLabel struct {
+	name, value string
+}
+
+type remoteSeries struct {
+	labels      []remoteLabel
+	value       float64
+	timestampMs int64
+}
+
+// NewRemoteWriter creates a remote writer of the metrics in the default registry
+func NewRemoteWriter(c RemoteWriteCfg) *RemoteWriter {
+	client := retryablehttp.NewClient()
+	client.HTTPClient.Timeout = util.TimeDuration(c.TimeoutSeconds, 30, time.Second)
+	client.RetryWaitMin = time.Second
+	client.RetryWaitMax = 30 * time.Second
+	client.RetryMax = defaultRemoteWriteRetries
+	if c.Retries != nil {
+		client.RetryMax = *c.Retries
+	}
+	client.CheckRetry = remoteWriteRetryPolicy
+
+	batchSize := defaultRemoteWriteBatchSize
+	if c.BatchSize > 0 {
+		batchSize = c.BatchSize
+	}
+	return &RemoteWriter{
+		url:            c.URL,
+		authorization:  c.Authorization,
+		batchSize:      batchSize,
+		externalLabels: c.ExternalLabels,
+		metricPrefixes: c.MetricPrefixes,
+		gatherer:       prometheus.DefaultGatherer,
+		client:         client,
+	}
+}
+
+// remoteWriteRetryPolicy retries on the connection errors, 5xx and 429 as the remote write spec
+func remoteWriteRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() == nil && err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true, nil
+	}
+	return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+}
+
+// Write gathers the metrics and sends them in batches
+func (w *RemoteWriter) Write(ctx context.Context) error {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		// a partial gathering is still written
+		log.Errorf("gather metrics for remote write error %v", err)
+	}
+	series := remoteWriteSeries(families, w.metricPrefixes, w.externalLabels, time.Now())
+	for start := 0; start < len(series); start += w.batchSize {
+		end := util.MinInt(start+w.batchSize, len(series))
+		if err := w.send(ctx, series[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *RemoteWriter) send(ctx context.Context, series []remoteSeries) error {
+	req, err := retryablehttp.NewRequest(http.MethodPost, w.url, snappy.Encode(nil, encodeWriteRequest(series)))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.authorization != "" {
+		req.Header.Set("Authorization", w.authorization)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote write to %s error %v", w.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("remote write to %s error status code %d %s", w.url, resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// hasMetricPrefix returns whether the metric name has one of the prefixes, every name matches no prefix
+func hasMetricPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return len(prefixes) == 0
+}
+
+// remoteWriteSeries converts the metric families of the name prefixes, or every family without a prefix, to the series of the remote write
+// The histograms and the summaries are flattened into the series of the text exposition format.
+func remoteWriteSeries(families []*dto.MetricFamily, prefixes []string, externalLabels map[string]string, now time.Time) []remoteSeries {
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	series := []remoteSeries{}
+	for _, f := range families {
+		name := f.GetName()
+		if !hasMetricPrefix(name, prefixes) {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			ts := nowMs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(suffix string, value float64, extra ...string) {
+				series = append(series, remoteSeries{
+					labels:      remoteLabels(name+suffix, m.GetLabel(), externalLabels, extra...),
+					value:       value,
+					timestampMs: ts,
+				})
+			}
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add("_bucket", float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound()))
+				}
+				add("_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+// remoteLabels returns the sorted labels of a series, the external labels do not override the metric labels
+func remoteLabels(name string, pairs []*dto.LabelPair, externalLabels map[string]string, extra ...string) []remoteLabel {
+	labels := map[string]string{}
+	for k, v := range externalLabels {
+		labels[k] = v
+	}
+	for _, p := range pairs {
+		labels[p.GetName()] = p.GetValue()
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	labels["__name__"] = name
+
+	rc := make([]remoteLabel, 0, len(labels))
+	for k, v := range labels {
+		rc = append(rc, remoteLabel{name: k, value: v})
+	}
+	sort.Slice(rc, func(i, j int) bool { return rc[i].name < rc[j].name })
+	return rc
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes the prompb.WriteRequest of the series
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteSeries) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestampMs))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+// RemoteWriteThread is the daemon thread that writes the metrics to the Prometheus remote write endpoint
+// The metrics are gathered from the in-process registry, they do not need to be exposed over http.
+func RemoteWriteThread() {
+	promCfg := GetConfig().PrometheusConfig
+	if promCfg.PrometheusProxyURL != "" {
+		log.Warnf("prometheusProxyURL is no longer supported, configure prometheusConfig.remoteWrite instead")
+	}
+	if promCfg.RemoteWrite.URL == "" {
+		log.Infof("This process is not configured to remote write metrics to Prometheus.")
+		return
+	}
+
+	log.Infof("remote write metrics to %s", promCfg.RemoteWrite.URL)
+	writer := NewRemoteWriter(promCfg.RemoteWrite)
+	RunInterval(func() {
+		if err := writer.Write(context.Background()); err != nil {
+			log.Errorf("remote write metrics error %v", err)
+		}
+	}, util.TimeDuration(promCfg.RemoteWrite.IntervalSeconds, 15, time.Second))
+}
@@ -0,0 +1,166 @@
+package cfg
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest decodes the series of a prompb.WriteRequest into the __name__ and the labels
+func decodeWriteRequest(tb testing.TB, b []byte) []map[string]string {
+	fields := func(b []byte, fn func(num protowire.Number, v []byte, u uint64)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			assert(tb, n > 0, "invalid tag")
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				assert(tb, n > 0, "invalid bytes")
+				fn(num, v, 0)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				assert(tb, n > 0, "invalid fixed64")
+				fn(num, nil, v)
+				b = b[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				assert(tb, n > 0, "invalid varint")
+				fn(num, nil, v)
+				b = b[n:]
+			default:
+				tb.Fatalf("unexpected wire type %d", typ)
+			}
+		}
+	}
+
+	series := []map[string]string{}
+	fields(b, func(_ protowire.Number, ts []byte, _ uint64) {
+		s := map[string]string{}
+		fields(ts, func(num protowire.Number, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				var name string
+				fields(v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						s[name] = string(v)
+					}
+				})
+			case 2:
+				fields(v, func(num protowire.Number, _ []byte, u uint64) {
+					if num == 1 {
+						s["value"] = formatFloat(math.Float64frombits(u))
+					}
+				})
+			}
+		})
+		series = append(series, s)
+	})
+	return series
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var lock sync.Mutex
+	var requests int
+	series := []map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert(t, "snappy" == r.Header.Get("Content-Encoding"), "snappy encoding")
+		assert(t, "Bearer secret" == r.Header.Get("Authorization"), "authorization header")
+		body, err := ioutil.ReadAll(r.Body)
+		errNil(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		errNil(t, err)
+		series = append(series, decodeWriteRequest(t, decoded)...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pulsar_remote_write_test"}, []string{"device", "region"})
+	gauge.WithLabelValues("cluster-a", "us-east").Set(42)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "pulsar_remote_write_test_hst", Buckets: []float64{10}})
+	histogram.Observe(5)
+	ignored := prometheus.NewGauge(prometheus.GaugeOpts{Name: "go_remote_write_test"})
+	registry.MustRegister(gauge, histogram, ignored)
+
+	writer := NewRemoteWriter(RemoteWriteCfg{
+		URL:            server.URL,
+		Authorization:  "Bearer secret",
+		BatchSize:      2,
+		ExternalLabels: map[string]string{"region": "external", "replica": "a"},
+		MetricPrefixes: []string{"pulsar"},
+	})
+	writer.gatherer = registry
+	writer.client.RetryWaitMin = time.Millisecond
+	writer.client.RetryWaitMax = time.Millisecond
+	errNil(t, writer.Write(context.Background()))
+
+	// a gauge and the 10 and +Inf buckets, the sum and the count of the histogram in 3 batches after a retry
+	assert(t, 4 == requests, "batched requests after a retry, %d requests", requests)
+	assert(t, 5 == len(series), "only the pulsar series are written, %d series", len(series))
+	g := series[0]
+	assert(t, "pulsar_remote_write_test" == g["__name__"] && "42" == g["value"], "gauge series %v", g)
+	assert(t, "us-east" == g["region"] && "a" == g["replica"], "the external labels do not override the metric labels %v", g)
+	assert(t, "pulsar_remote_write_test_hst_bucket" == series[1]["__name__"] && "10" == series[1]["le"] && "1" == series[1]["value"],
+		"histogram bucket %v", series[1])
+	assert(t, "+Inf" == series[2]["le"], "histogram +Inf bucket %v", series[2])
+	assert(t, "pulsar_remote_write_test_hst_count" == series[4]["__name__"] && "1" == series[4]["value"], "histogram count %v", series[4])
+
+	// every metric is written without a prefix
+	families, err := registry.Gather()
+	errNil(t, err)
+	all := remoteWriteSeries(families, nil, nil, time.Now())
+	assert(t, 6 == len(all) && "go_remote_write_test" == all[0].labels[0].value, "every series is written, %d series", len(all))
+}
+
+func TestRemoteWriteRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "pulsar_remote_write_rejected"}))
+	writer := NewRemoteWriter(RemoteWriteCfg{URL: server.URL})
+	writer.gatherer = registry
+	err := writer.Write(context.Background())
+	assert(t, err != nil, "a rejected write is an error")
+	assert(t, "remote write to "+server.URL+" error status code 400 out of order sample" == err.Error(), "error %v", err)
+}
+
+func TestRemoteWriteWithoutRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "pulsar_remote_write_no_retry"}))
+	retries := 0
+	writer := NewRemoteWriter(RemoteWriteCfg{URL: server.URL, Retries: &retries})
+	writer.gatherer = registry
+	assert(t, writer.Write(context.Background()) != nil, "a failed write is an error")
+	assert(t, 1 == atomic.LoadInt32(&requests), "zero retries disables the retries, %d requests", requests)
+}
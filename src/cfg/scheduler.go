@@ -0,0 +1,184 @@
+package cfg
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/schedule"
+)
+
+// Scheduler runs the probes and the periodic tasks until its context is done
+type Scheduler struct {
+	ctx context.Context
+	// tracks the scheduled loops and their in-flight runs
+	wg sync.WaitGroup
+}
+
+var (
+	scheduler     = NewScheduler(context.Background())
+	schedulerLock = &sync.RWMutex{}
+)
+
+// NewScheduler creates a scheduler that stops ticking when the context is done
+func NewScheduler(ctx context.Context) *Scheduler {
+	return &Scheduler{ctx: ctx}
+}
+
+// SetScheduler sets the scheduler that owns the probes and the periodic tasks started afterwards
+func SetScheduler(s *Scheduler) {
+	schedulerLock.Lock()
+	defer schedulerLock.Unlock()
+	scheduler = s
+}
+
+func getScheduler() *Scheduler {
+	schedulerLock.RLock()
+	defer schedulerLock.RUnlock()
+	return scheduler
+}
+
+// Context returns the context of the scheduler
+func (s *Scheduler) Context() context.Context {
+	return s.ctx
+}
+
+// Go runs fn in a goroutine that is waited for by the scheduler
+func (s *Scheduler) Go(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// Every runs fn at the interval until the context is done, the first run is immediate if runNow is true
+func (s *Scheduler) Every(interval time.Duration, runNow bool, fn func()) {
+	s.loop(interval, firstRunDelay(interval, runNow), nil, fn)
+}
+
+// Schedule runs the probe at its interval until the probe is stopped or the context is done
+// A tick is skipped while the previous run is still in progress.
+func (s *Scheduler) Schedule(p *Probe, runNow bool) {
+	s.ScheduleAfter(p, firstRunDelay(p.Interval, runNow))
+}
+
+// ScheduleAfter runs the probe at its interval with the first run after the delay
+// A probe with a cron schedule runs at every scheduled minute instead, the delay does not apply.
+func (s *Scheduler) ScheduleAfter(p *Probe, delay time.Duration) {
+	if p.cron != nil {
+		s.cronLoop(p.cron, p.stop, p.runScheduled)
+		return
+	}
+	s.loop(p.Interval, delay, p.stop, p.runScheduled)
+}
+
+func firstRunDelay(interval time.Duration, runNow bool) time.Duration {
+	if runNow {
+		return 0
+	}
+	return interval
+}
+
+// loop runs fn at the interval after the first run delay, a nil stop channel never stops the loop
+// The runs are at a fixed rate with the configured jitter, the ones missed by a long run are dropped.
+func (s *Scheduler) loop(interval, delay time.Duration, stop <-chan struct{}, fn func()) {
+	startupJitter := time.Duration(GetConfig().SchedulerConfig.StartupJitterSeconds) * time.Second
+	next := time.Now().Add(delay)
+	s.repeat(delay+randomDuration(startupJitter), stop, fn, func(now time.Time) (time.Duration, bool) {
+		next = next.Add(interval)
+		for !next.After(now) {
+			next = next.Add(interval)
+		}
+		jitter := interval * time.Duration(GetConfig().SchedulerConfig.JitterPercent) / 100
+		return next.Sub(now) + randomDuration(jitter), true
+	})
+}
+
+// cronLoop runs fn at every scheduled minute of the cron schedule
+func (s *Scheduler) cronLoop(c *schedule.Cron, stop <-chan struct{}, fn func()) {
+	after := func(now time.Time) (time.Duration, bool) {
+		next := c.Next(now)
+		return next.Sub(now), !next.IsZero()
+	}
+	first, ok := after(time.Now())
+	if !ok {
+		log.Warnf("cron schedule %s has no scheduled minute", c)
+		return
+	}
+	s.repeat(first, stop, fn, after)
+}
+
+// repeat runs fn after the first delay and then after every delay returned by next until next returns false
+func (s *Scheduler) repeat(first time.Duration, stop <-chan struct{}, fn func(), next func(now time.Time) (time.Duration, bool)) {
+	s.Go(func() {
+		timer := time.NewTimer(first)
+		defer timer.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-timer.C:
+				// the context may be done while the timer fires
+				if s.ctx.Err() != nil {
+					return
+				}
+				fn()
+			}
+			delay, ok := next(time.Now())
+			if !ok {
+				return
+			}
+			timer.Reset(delay)
+		}
+	})
+}
+
+// randomDuration returns a random duration between zero and max
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// firstRunOffset is the delay of the first run of the i-th of n probes started together
+func (policy SchedulerCfg) firstRunOffset(i, n int, interval time.Duration) time.Duration {
+	if policy.Spread {
+		return interval * time.Duration(i) / time.Duration(n)
+	}
+	return time.Duration(i*policy.StaggerSeconds) * time.Second
+}
+
+// Wait waits for the scheduled loops and their in-flight runs to return after the context is done
+// It returns false if they do not return within the timeout.
+func (s *Scheduler) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Shutdown releases the resources once the scheduler has stopped
+// It waits for the pending notifications, exports the last traces, closes the cached Pulsar clients
+// and writes the pending incident state changes.
+func Shutdown(timeout time.Duration) {
+	if !FlushNotifications(timeout) {
+		log.Warnf("pending notifications are not sent within %v", timeout)
+	}
+	flushOTLPExport(timeout)
+	CloseClients()
+	flushState()
+	log.Infof("pulsar monitor is shut down")
+}
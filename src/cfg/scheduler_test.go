@@ -0,0 +1,162 @@
+package cfg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewScheduler(ctx)
+
+	var ticks, completed int32
+	started := make(chan struct{}, 1)
+	s.Every(10*time.Millisecond, true, func() {
+		atomic.AddInt32(&ticks, 1)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		// an in-flight run outlives the cancellation
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&completed, 1)
+	})
+
+	p := registerProbe(&Probe{Name: "scheduler-probe", Type: ProbeTypeSite, Interval: 10 * time.Millisecond, run: func(ctx context.Context) {}})
+	defer reconcileProbes(nil)
+	s.Schedule(p, true)
+
+	<-started
+	cancel()
+	assert(t, s.Wait(time.Second), "the scheduler stops")
+	assert(t, atomic.LoadInt32(&ticks) == atomic.LoadInt32(&completed), "in-flight runs are completed")
+
+	stopped := atomic.LoadInt32(&ticks)
+	time.Sleep(50 * time.Millisecond)
+	assert(t, stopped == atomic.LoadInt32(&ticks), "no run after the scheduler stops")
+}
+
+func TestSchedulerStopProbe(t *testing.T) {
+	s := NewScheduler(context.Background())
+	var runs int32
+	p := registerProbe(&Probe{Name: "stopped-probe", Type: ProbeTypeSite, Interval: 5 * time.Millisecond, run: func(ctx context.Context) {
+		atomic.AddInt32(&runs, 1)
+	}})
+	defer reconcileProbes(nil)
+
+	s.Schedule(p, true)
+	time.Sleep(30 * time.Millisecond)
+	p.Stop()
+	assert(t, s.Wait(time.Second), "a stopped probe is no longer scheduled")
+	assert(t, atomic.LoadInt32(&runs) > 1, "probe runs at the interval")
+}
+
+func TestProbeTimeout(t *testing.T) {
+	defer reconcileProbes(nil)
+	saved := probeCancelGrace
+	probeCancelGrace = 10 * time.Millisecond
+	defer func() { probeCancelGrace = saved }()
+
+	// a run that observes the cancellation reports its own result
+	p := registerProbe(&Probe{Name: "cancelled-probe", Type: ProbeTypeSite, Interval: time.Minute, Timeout: 20 * time.Millisecond,
+		run: func(ctx context.Context) {
+			<-ctx.Done()
+			recordProbeResult("cancelled-probe", ProbeTypeSite, 0, ctx.Err())
+		}})
+	status, err := p.Run()
+	errNil(t, err)
+	assert(t, 1 == status.Runs && !status.Healthy, "cancelled run is recorded once, %d runs", status.Runs)
+	assert(t, context.DeadlineExceeded.Error() == status.Error, "cancelled run error %s", status.Error)
+
+	// a run that ignores the cancellation is abandoned and the next runs are skipped until it returns
+	release := make(chan struct{})
+	var runs int32
+	p = registerProbe(&Probe{Name: "hung-probe", Type: ProbeTypeSite, Interval: time.Minute, Timeout: 20 * time.Millisecond,
+		run: func(ctx context.Context) {
+			if atomic.AddInt32(&runs, 1) == 1 {
+				<-release
+			}
+		}})
+	status, err = p.Run()
+	errNil(t, err)
+	assert(t, 1 == status.Runs && !status.Healthy, "hung run is recorded as a failure")
+	assert(t, strings.Contains(status.Error, "timed out after 20ms"), "hung run error %s", status.Error)
+
+	p.runScheduled()
+	assert(t, 1 == atomic.LoadInt32(&runs), "scheduled run is skipped while the previous run is in progress")
+	status, err = p.Run()
+	assert(t, errors.Is(err, errProbeRunning), "on demand run is refused while the previous run is in progress, %v", err)
+	assert(t, 1 == atomic.LoadInt32(&runs) && 1 == status.Runs, "on demand run does not overlap the previous run")
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&p.running) == 1 {
+		assert(t, time.Now().Before(deadline), "the abandoned run has not returned")
+		time.Sleep(time.Millisecond)
+	}
+	p.runScheduled()
+	assert(t, 2 == atomic.LoadInt32(&runs), "scheduled run resumes once the previous run returns")
+}
+
+func TestSchedulerFirstRunOffset(t *testing.T) {
+	staggered := SchedulerCfg{StaggerSeconds: 5}
+	assert(t, 0 == staggered.firstRunOffset(0, 3, time.Minute), "the first probe is not delayed")
+	assert(t, 10*time.Second == staggered.firstRunOffset(2, 3, time.Minute), "probes are staggered")
+
+	spread := SchedulerCfg{StaggerSeconds: 5, Spread: true}
+	assert(t, 20*time.Second == spread.firstRunOffset(1, 3, time.Minute), "probes are spread across the interval")
+	assert(t, 40*time.Second == spread.firstRunOffset(2, 3, time.Minute), "probes are spread across the interval")
+
+	for i := 0; i < 100; i++ {
+		d := randomDuration(time.Second)
+		assert(t, d >= 0 && d <= time.Second, "random duration %v out of range", d)
+	}
+	assert(t, 0 == randomDuration(0), "no jitter")
+}
+
+func TestSchedulerScheduleAfter(t *testing.T) {
+	s := NewScheduler(context.Background())
+	var runs int32
+	p := registerProbe(&Probe{Name: "delayed-probe", Type: ProbeTypeSite, Interval: time.Minute, run: func(ctx context.Context) {
+		atomic.AddInt32(&runs, 1)
+	}})
+	defer reconcileProbes(nil)
+
+	s.ScheduleAfter(p, 50*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert(t, 0 == atomic.LoadInt32(&runs), "the first run is delayed")
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runs) == 0 {
+		assert(t, time.Now().Before(deadline), "the delayed run has not started")
+		time.Sleep(5 * time.Millisecond)
+	}
+	p.Stop()
+	assert(t, s.Wait(time.Second), "a stopped probe is no longer scheduled")
+}
+
+func TestProbeActiveHours(t *testing.T) {
+	defer reconcileProbes(nil)
+	var runs int32
+	p := registerProbe(&Probe{Name: "off-peak-probe", Type: ProbeTypePubSub, Interval: time.Minute, run: func(ctx context.Context) {
+		atomic.AddInt32(&runs, 1)
+	}})
+
+	// the hour that has just ended is never active now
+	now := time.Now().UTC()
+	inactive := fmt.Sprintf("%02d:00-%02d:00", (now.Hour()+23)%24, now.Hour())
+	p.withSchedule(ProbeScheduleCfg{Schedule: "0 2 * * *", ActiveHours: []string{inactive}})
+	assert(t, p.cron != nil && "0 2 * * *" == p.cron.String(), "cron schedule is set")
+	p.runScheduled()
+	assert(t, 0 == atomic.LoadInt32(&runs), "scheduled run is skipped outside the active hours")
+	p.Run()
+	assert(t, 1 == atomic.LoadInt32(&runs), "on demand run ignores the active hours")
+
+	p.withSchedule(ProbeScheduleCfg{ActiveHours: []string{"00:00-24:00"}})
+	p.runScheduled()
+	assert(t, 2 == atomic.LoadInt32(&runs), "scheduled run within the active hours")
+}
@@ -0,0 +1,301 @@
+package cfg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/schedule"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+// silences and maintenance windows suppress incidents and alerts during planned operations, i.e. Pulsar upgrade.
+// Probes keep running and recording metrics while the components are silenced.
+
+// Probe types can be used in silence matchers
+const (
+	ProbeTypePubSub         = "pubsub"
+	ProbeTypePartitionTopic = "partition-topic"
+	ProbeTypeWebSocket      = "websocket"
+	ProbeTypeSite           = "site"
+	ProbeTypeTenants        = "tenants"
+	ProbeTypeBroker         = "broker"
+	ProbeTypeK8s            = "k8s"
+)
+
+// SilenceMatcher matches components with glob patterns, i.e. "cluster-*".
+// All specified patterns have to match. An empty pattern matches any value.
+type SilenceMatcher struct {
+	Component string `json:"component"`
+	Cluster   string `json:"cluster"`
+	Probe     string `json:"probe"`
+}
+
+// Silence suppresses incidents and alerts of the matched components between the start and end time
+type Silence struct {
+	ID       string         `json:"id"`
+	Matchers SilenceMatcher `json:"matchers"`
+	StartsAt time.Time      `json:"startsAt"`
+	EndsAt   time.Time      `json:"endsAt"`
+	Comment  string         `json:"comment"`
+}
+
+// probeLabels are the labels of a component that silence matchers are evaluated against
+type probeLabels struct {
+	component string
+	cluster   string
+	probe     string
+}
+
+var (
+	// key is the component name
+	componentLabels     = make(map[string]probeLabels)
+	componentLabelsLock = &sync.RWMutex{}
+
+	// silences created at runtime, key is the silence id
+	silences     = make(map[string]Silence)
+	silencesLock = &sync.RWMutex{}
+
+	// key is the component, value is the reason of the silence, used to log silence state changes
+	silencedComponents = util.NewSycMap()
+
+	// key is the schedule and timezone, value is *schedule.Cron or the parse error
+	maintenanceSchedules = util.NewSycMap()
+)
+
+func (m SilenceMatcher) empty() bool {
+	return m.Component == "" && m.Cluster == "" && m.Probe == ""
+}
+
+func globMatch(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+// matches evaluates the labels, a matcher without any pattern never matches
+func (m SilenceMatcher) matches(labels probeLabels) bool {
+	return !m.empty() &&
+		globMatch(m.Component, labels.component) &&
+		globMatch(m.Cluster, labels.cluster) &&
+		globMatch(m.Probe, labels.probe)
+}
+
+func (m SilenceMatcher) validate() error {
+	if m.empty() {
+		return fmt.Errorf("at least one of component, cluster and probe matchers must be specified")
+	}
+	for _, pattern := range []string{m.Component, m.Cluster, m.Probe} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid matcher pattern %s", pattern)
+		}
+	}
+	return nil
+}
+
+// Active returns whether the silence is in effect at the time
+func (s Silence) Active(t time.Time) bool {
+	return !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+// registerProbeComponent registers the labels of a component reported by a probe
+func registerProbeComponent(component, cluster, probeType string) {
+	componentLabelsLock.Lock()
+	componentLabels[component] = probeLabels{
+		component: component,
+		cluster:   cluster,
+		probe:     probeType,
+	}
+	componentLabelsLock.Unlock()
+}
+
+// lookupLabels returns the labels of a component, or the component registered with the longest prefix
+// since verbose alerts use the component with a suffix, i.e. cluster-latency-err
+func lookupLabels(component string) probeLabels {
+	componentLabelsLock.RLock()
+	defer componentLabelsLock.RUnlock()
+	if labels, ok := componentLabels[component]; ok {
+		return labels
+	}
+	labels, prefixLen := probeLabels{component: component}, 0
+	for k, v := range componentLabels {
+		if len(k) > prefixLen && strings.HasPrefix(component, k) {
+			labels, prefixLen = v, len(k)
+		}
+	}
+	return labels
+}
+
+// newID returns a random id in hex
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// AddSilence validates and adds a silence, the start time is now if it is not specified
+func AddSilence(s Silence) (Silence, error) {
+	if err := s.Matchers.validate(); err != nil {
+		return s, err
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return s, fmt.Errorf("silence end time %v must be after the start time %v", s.EndsAt, s.StartsAt)
+	}
+	if s.ID == "" {
+		s.ID = newID()
+	}
+
+	silencesLock.Lock()
+	silences[s.ID] = s
+	silencesLock.Unlock()
+	log.Infof("silence %s added for %+v from %v to %v, %s", s.ID, s.Matchers, s.StartsAt, s.EndsAt, s.Comment)
+	saveState()
+	return s, nil
+}
+
+// RemoveSilence removes a silence created at runtime, returns false if the silence does not exist
+func RemoveSilence(id string) bool {
+	silencesLock.Lock()
+	_, ok := silences[id]
+	delete(silences, id)
+	silencesLock.Unlock()
+	if ok {
+		log.Infof("silence %s removed", id)
+		saveState()
+	}
+	return ok
+}
+
+// GetSilences returns the configured silences and the unexpired silences created at runtime
+func GetSilences() []Silence {
+	list := []Silence{}
+	for i, s := range GetConfig().Silences {
+		if s.ID == "" {
+			s.ID = fmt.Sprintf("config-%d", i)
+		}
+		list = append(list, s)
+	}
+
+	now := time.Now()
+	silencesLock.Lock()
+	for k, s := range silences {
+		if !now.Before(s.EndsAt) {
+			// evict expired silence
+			delete(silences, k)
+			continue
+		}
+		list = append(list, s)
+	}
+	silencesLock.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartsAt.Before(list[j].StartsAt) })
+	return list
+}
+
+func maintenanceSchedule(w MaintenanceWindowCfg) (*schedule.Cron, error) {
+	key := w.Schedule + "|" + w.Timezone
+	switch v := maintenanceSchedules.Get(key).(type) {
+	case *schedule.Cron:
+		return v, nil
+	case error:
+		return nil, v
+	}
+
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		log.Errorf("maintenance window %s is ignored, error %v", w.Name, err)
+		maintenanceSchedules.Put(key, err)
+		return nil, err
+	}
+	c, err := schedule.ParseInLocation(w.Schedule, loc)
+	if err != nil {
+		log.Errorf("maintenance window %s is ignored, error %v", w.Name, err)
+		maintenanceSchedules.Put(key, err)
+		return nil, err
+	}
+	maintenanceSchedules.Put(key, c)
+	return c, nil
+}
+
+// silenceReason returns the silence or maintenance window in effect for the component, or empty if there is none
+func silenceReason(labels probeLabels, now time.Time) string {
+	for _, s := range GetSilences() {
+		if s.Active(now) && s.Matchers.matches(labels) {
+			return "silence " + s.ID
+		}
+	}
+
+	for _, w := range GetConfig().MaintenanceWindows {
+		if !w.Matchers.matches(labels) {
+			continue
+		}
+		c, err := maintenanceSchedule(w)
+		if err != nil {
+			continue
+		}
+		if start, ok := c.Active(now, time.Duration(w.DurationMinutes)*time.Minute); ok {
+			return fmt.Sprintf("maintenance window %s started at %v", w.Name, start)
+		}
+	}
+	return ""
+}
+
+// IsSilenced returns whether the incidents and alerts of the component are silenced.
+// The silence state change is logged and exposed as a gauge.
+func IsSilenced(component string) bool {
+	// verbose alerts are tracked by the probe component
+	labels := lookupLabels(component)
+	component = labels.component
+	reason := silenceReason(labels, time.Now())
+	previous, _ := silencedComponents.Get(component).(string)
+	if reason != previous {
+		if reason == "" {
+			log.Infof("%s is no longer silenced", component)
+			silencedComponents.Remove(component)
+		} else {
+			log.Infof("%s is silenced by %s", component, reason)
+			silencedComponents.Put(component, reason)
+		}
+	}
+
+	if reason == "" {
+		PromGauge(SilencedGaugeOpt(), component, 0)
+		return false
+	}
+	PromGauge(SilencedGaugeOpt(), component, 1)
+	return true
+}
+
+func runtimeSilences() []Silence {
+	silencesLock.RLock()
+	defer silencesLock.RUnlock()
+	list := []Silence{}
+	for _, s := range silences {
+		list = append(list, s)
+	}
+	return list
+}
+
+func restoreSilences(list []Silence) {
+	now := time.Now()
+	silencesLock.Lock()
+	defer silencesLock.Unlock()
+	for _, s := range list {
+		if now.Before(s.EndsAt) {
+			silences[s.ID] = s
+		}
+	}
+}
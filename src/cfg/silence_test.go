@@ -0,0 +1,64 @@
+package cfg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSilenceIncident(t *testing.T) {
+	sink := &testSink{}
+	defer useTestSinks(sink)()
+
+	component := "silenced-component"
+	registerProbeComponent(component, "silenced-cluster", ProbeTypeWebSocket)
+
+	_, err := AddSilence(Silence{EndsAt: time.Now().Add(time.Hour)})
+	assert(t, err != nil, "silence requires a matcher")
+	_, err = AddSilence(Silence{Matchers: SilenceMatcher{Cluster: "silenced-*"}, EndsAt: time.Now().Add(-time.Hour)})
+	assert(t, err != nil, "silence must end after it starts")
+
+	silence, err := AddSilence(Silence{
+		Matchers: SilenceMatcher{Cluster: "silenced-*", Probe: ProbeTypeWebSocket},
+		EndsAt:   time.Now().Add(time.Hour),
+		Comment:  "pulsar upgrade",
+	})
+	errNil(t, err)
+	assert(t, IsSilenced(component), "component is silenced by the cluster and probe matchers")
+	assert(t, IsSilenced(component+"-websocket-err"), "verbose alert is silenced by the probe component")
+	assert(t, !IsSilenced("other-component"), "other component is not silenced")
+
+	policy := AlertPolicyCfg{Ceiling: 1}
+	ReportIncident(component, "silenced-cluster", "failure", "description", &policy)
+	assert(t, 0 == len(sink.created), "silenced incident is not created")
+	assert(t, StateFiring == incidentTrackers[component].State, "alert policy still tracks the silenced component")
+
+	assert(t, RemoveSilence(silence.ID), "silence is removed")
+	assert(t, !RemoveSilence(silence.ID), "silence is removed only once")
+	ReportIncident(component, "silenced-cluster", "failure", "description", &policy)
+	assert(t, 1 == len(sink.created), "incident is created after the silence is removed")
+	ClearIncident(component)
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	registerProbeComponent("maintenance-component", "maintenance-cluster", ProbeTypePubSub)
+	GetConfig().MaintenanceWindows = []MaintenanceWindowCfg{
+		{
+			Name:            "invalid",
+			Schedule:        "* * *",
+			DurationMinutes: 60,
+			Matchers:        SilenceMatcher{Probe: ProbeTypePubSub},
+		},
+		{
+			Name:            "every-hour",
+			Schedule:        "@hourly",
+			DurationMinutes: 30,
+			Matchers:        SilenceMatcher{Component: "maintenance-*"},
+		},
+	}
+	defer func() { GetConfig().MaintenanceWindows = nil }()
+
+	labels := lookupLabels("maintenance-component")
+	hour := time.Now().UTC().Truncate(time.Hour)
+	assert(t, "" != silenceReason(labels, hour.Add(29*time.Minute)), "component is silenced in the maintenance window")
+	assert(t, "" == silenceReason(labels, hour.Add(30*time.Minute)), "component is not silenced after the maintenance window")
+}
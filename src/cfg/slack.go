@@ -19,6 +19,47 @@ type SlackMessage struct {
 	IconEmogi string `json:"icon_emogi"`
 }
 
+const slackSinkName = "slack"
+
+// SlackSink posts alert messages and incident events to a Slack webhook
+type SlackSink struct {
+	webhookURL string
+}
+
+func newSlackSink(config *Configuration) IncidentSink {
+	if config.SlackConfig.AlertURL == "" {
+		return nil
+	}
+	return &SlackSink{webhookURL: config.SlackConfig.AlertURL}
+}
+
+// Name returns the sink name
+func (s *SlackSink) Name() string {
+	return slackSinkName
+}
+
+// Notify posts a message to the Slack channel
+func (s *SlackSink) Notify(msg string) error {
+	return SendSlackNotification(s.webhookURL, SlackMessage{
+		Text: msg,
+	})
+}
+
+// CreateIncident posts a new incident to the Slack channel
+func (s *SlackSink) CreateIncident(incident Incident) (string, error) {
+	return "", s.Notify(fmt.Sprintf("report incident as pager escalation %v", incident))
+}
+
+// UpdateIncident posts a still open incident to the Slack channel
+func (s *SlackSink) UpdateIncident(incident Incident, ref string) error {
+	return s.Notify(fmt.Sprintf("incident is still open %v", incident))
+}
+
+// ResolveIncident posts the incident resolution to the Slack channel
+func (s *SlackSink) ResolveIncident(incident Incident, ref string) error {
+	return s.Notify(fmt.Sprintf("incident on %s is automatically resolved", incident.Entity))
+}
+
 // AlertVerbosity contains attributes required to calculate whether verbose alert is required or not
 type AlertVerbosity struct {
 	lastAlertTime time.Time
@@ -37,6 +78,10 @@ var componentsAlert = util.NewSycMap()
 
 // VerboseAlert is able to reduce the verbosity to Slack channel
 func VerboseAlert(component, message string, silenceWindow time.Duration) {
+	if IsSilenced(component) {
+		log.Infof("silenced alert %s", message)
+		return
+	}
 	if GetConfig().SlackConfig.Verbose {
 		Alert(message)
 		return
@@ -55,17 +100,13 @@ func VerboseAlert(component, message string, silenceWindow time.Duration) {
 	Alert(message)
 }
 
-// Alert alerts to slack, email, text.
+// Alert alerts to all active notifiers, i.e. slack, email, text.
 func Alert(msg string) {
 	log.Errorf("Alert %s", msg)
-	if GetConfig().SlackConfig.AlertURL == "" {
-		return
-	}
-	err := SendSlackNotification(GetConfig().SlackConfig.AlertURL, SlackMessage{
-		Text: msg,
-	})
-	if err != nil {
-		log.Errorf("slack error %v", err)
+	for _, notifier := range getNotifiers() {
+		if err := notifier.Notify(msg); err != nil {
+			log.Errorf("%s notifier error %v", notifier.Name(), err)
+		}
 	}
 }
 
@@ -0,0 +1,265 @@
+package cfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// persist open incidents, downtime tracking and alert policy counters in a local file
+// so open incidents can still be resolved by the sinks after the monitor restarts
+
+// IncidentReconciler is an optional interface of IncidentSink.
+// It reports whether an incident is still open on the sink, i.e. it is not closed manually.
+type IncidentReconciler interface {
+	IsIncidentOpen(incident Incident, ref string) (bool, error)
+}
+
+type persistedIncident struct {
+	Incident  Incident          `json:"incident"`
+	Refs      map[string]string `json:"refs"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type monitorState struct {
+	Incidents map[string]persistedIncident    `json:"incidents"`
+	Downtime  map[string]time.Time            `json:"downtime"`
+	Trackers  map[string]*IncidentAlertPolicy `json:"trackers"`
+	Silences  []Silence                       `json:"silences"`
+	SavedAt   time.Time                       `json:"savedAt"`
+}
+
+// serialize the state file write
+var stateFileLock = &sync.Mutex{}
+
+// stateSaveDelay debounces the state writes of the alert policy evaluations of every probe run
+var stateSaveDelay = 10 * time.Second
+
+var (
+	stateSaveLock sync.Mutex
+	// the pending write of the changes since the last write, nil if the state file is up to date
+	stateSaveTimer *time.Timer
+)
+
+func stateFilePath() string {
+	return GetConfig().StateFilePath
+}
+
+// markStateDirty schedules a state write, the changes within the stateSaveDelay are written together
+// The alert policy counters change on every probe run, the incidents are saved at once by saveState.
+func markStateDirty() {
+	if stateFilePath() == "" {
+		return
+	}
+	stateSaveLock.Lock()
+	defer stateSaveLock.Unlock()
+	if stateSaveTimer == nil {
+		stateSaveTimer = time.AfterFunc(stateSaveDelay, flushState)
+	}
+}
+
+// flushState writes the pending state changes, if any
+func flushState() {
+	stateSaveLock.Lock()
+	pending := stateSaveTimer != nil
+	stateSaveLock.Unlock()
+	if pending {
+		saveState()
+	}
+}
+
+// saveState writes the current incident state to the state file, it includes the pending changes
+// it must not be called while holding incidentsLock or incidentTrackersLock
+func saveState() {
+	stateSaveLock.Lock()
+	if stateSaveTimer != nil {
+		stateSaveTimer.Stop()
+		stateSaveTimer = nil
+	}
+	stateSaveLock.Unlock()
+
+	path := stateFilePath()
+	if path == "" {
+		return
+	}
+
+	state := monitorState{
+		Incidents: make(map[string]persistedIncident),
+		Downtime:  make(map[string]time.Time),
+		Trackers:  make(map[string]*IncidentAlertPolicy),
+		Silences:  runtimeSilences(),
+		SavedAt:   time.Now(),
+	}
+
+	incidentsLock.RLock()
+	for k, v := range incidents {
+		state.Incidents[k] = persistedIncident{
+			Incident:  v.incident,
+			Refs:      v.refs,
+			CreatedAt: v.createdAt,
+		}
+	}
+	for k, v := range downtimeTracker {
+		state.Downtime[k] = v.createdAt
+	}
+	incidentsLock.RUnlock()
+
+	incidentTrackersLock.RLock()
+	for k, v := range incidentTrackers {
+		state.Trackers[k] = v
+	}
+	buf, err := json.Marshal(state)
+	incidentTrackersLock.RUnlock()
+	if err != nil {
+		log.Errorf("failed to marshal incident state %v", err)
+		return
+	}
+
+	stateFileLock.Lock()
+	defer stateFileLock.Unlock()
+	if err := writeFileAtomic(path, buf); err != nil {
+		log.Errorf("failed to save incident state to %s error %v", path, err)
+	}
+}
+
+// writeFileAtomic writes to a temporary file and renames it to avoid a partially written state file
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// LoadState restores the incident state from the state file and reconciles open incidents with the active sinks
+// The reconciliation runs in the background since a sink lookup retries for minutes while the sink is down.
+func LoadState() error {
+	path := stateFilePath()
+	if path == "" {
+		return nil
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Infof("no incident state file %s to restore", path)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	state := monitorState{}
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return fmt.Errorf("failed to parse incident state file %s error %v", path, err)
+	}
+
+	incidentsLock.Lock()
+	for k, v := range state.Incidents {
+		refs := v.Refs
+		if refs == nil {
+			refs = make(map[string]string)
+		}
+		incidents[k] = incidentRecord{
+			incident:  v.Incident,
+			refs:      refs,
+			createdAt: v.CreatedAt,
+		}
+	}
+	for k, v := range state.Downtime {
+		downtimeTracker[k] = incidentRecord{createdAt: v}
+	}
+	incidentsLock.Unlock()
+
+	incidentTrackersLock.Lock()
+	for k, v := range state.Trackers {
+		if v.Alerts == nil {
+			v.Alerts = make(map[time.Time]bool)
+		}
+		if v.Flapping {
+			PromGauge(FlappingGaugeOpt(), k, 1)
+		}
+		incidentTrackers[k] = v
+	}
+	incidentTrackersLock.Unlock()
+	restoreSilences(state.Silences)
+
+	log.Infof("restored %d open incidents and %d alert policy trackers saved at %v from %s",
+		len(state.Incidents), len(state.Trackers), state.SavedAt, path)
+
+	saveState()
+	getScheduler().Go(reconcileIncidents)
+	return nil
+}
+
+// reconcileIncidents drops the sink references that no longer can or need to be resolved.
+// The incident record is kept, so the downtime is accounted when the component recovers.
+// The probes may open and resolve incidents meanwhile, only the reconciled references are dropped.
+func reconcileIncidents() {
+	sinks := make(map[string]IncidentSink)
+	for _, sink := range getIncidentSinks() {
+		sinks[sink.Name()] = sink
+	}
+
+	incidentsLock.RLock()
+	records := make(map[string]incidentRecord)
+	for k, v := range incidents {
+		refs := make(map[string]string)
+		for name, ref := range v.refs {
+			refs[name] = ref
+		}
+		v.refs = refs
+		records[k] = v
+	}
+	incidentsLock.RUnlock()
+
+	changed := false
+	for component, record := range records {
+		dropped := make(map[string]string)
+		for name, ref := range record.refs {
+			sink, ok := sinks[name]
+			if !ok {
+				log.Warnf("%s incident reference %s dropped because sink %s is no longer active", component, ref, name)
+				dropped[name] = ref
+				continue
+			}
+			if reconciler, ok := sink.(IncidentReconciler); ok {
+				isOpen, err := reconciler.IsIncidentOpen(record.incident, ref)
+				if err != nil {
+					log.Errorf("%s failed to reconcile incident with sink %s error %v", component, name, err)
+				} else if !isOpen {
+					log.Infof("%s incident has been closed on sink %s", component, name)
+					dropped[name] = ref
+				}
+			}
+		}
+
+		incidentsLock.Lock()
+		current, ok := incidents[component]
+		for name, ref := range dropped {
+			if ok && current.refs[name] == ref {
+				delete(current.refs, name)
+				changed = true
+			}
+		}
+		incidentsLock.Unlock()
+		log.Infof("%s open incident since %v is reconciled, dropped sink references %v", component, record.createdAt, dropped)
+	}
+	if changed {
+		saveState()
+	}
+}
@@ -0,0 +1,110 @@
+package cfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type closedSink struct {
+	testSink
+	// the lookups wait until it is closed
+	release chan struct{}
+}
+
+func (s *closedSink) Name() string { return "closed" }
+
+func (s *closedSink) IsIncidentOpen(incident Incident, ref string) (bool, error) {
+	<-s.release
+	return false, nil
+}
+
+func TestPersistIncidentState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor-state")
+	errNil(t, err)
+	defer os.RemoveAll(dir)
+
+	GetConfig().StateFilePath = filepath.Join(dir, "state.json")
+	defer func() { GetConfig().StateFilePath = "" }()
+
+	sink := &testSink{}
+	closed := &closedSink{release: make(chan struct{})}
+	defer useTestSinks(sink, closed)()
+
+	policy := AlertPolicyCfg{Ceiling: 5}
+	ReportIncident("state-component2", "state-component2", "message", "description", &policy)
+	CreateIncident("state-component", "state-alias", "message", "description", "P2")
+	_, err = os.Stat(GetConfig().StateFilePath)
+	errNil(t, err)
+
+	// simulate a restart by dropping the in-memory state
+	incidentsLock.Lock()
+	delete(incidents, "state-component")
+	delete(downtimeTracker, "state-component")
+	incidentsLock.Unlock()
+	incidentTrackersLock.Lock()
+	delete(incidentTrackers, "state-component2")
+	incidentTrackersLock.Unlock()
+
+	errNil(t, LoadState())
+	refs := func() map[string]string {
+		incidentsLock.RLock()
+		defer incidentsLock.RUnlock()
+		refs := make(map[string]string)
+		for name, ref := range incidents["state-component"].refs {
+			refs[name] = ref
+		}
+		return refs
+	}
+	assert(t, "ref-state-component" == refs()["test"], "sink reference is restored")
+	assert(t, "ref-state-component" == refs()["closed"], "the state is restored before the sinks are looked up")
+
+	close(closed.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, ok := refs()["closed"]; ok; _, ok = refs()["closed"] {
+		assert(t, time.Now().Before(deadline), "reference to an incident closed on the sink is dropped")
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert(t, "ref-state-component" == refs()["test"], "sink reference is kept")
+
+	incidentTrackersLock.RLock()
+	tracker, ok := incidentTrackers["state-component2"]
+	incidentTrackersLock.RUnlock()
+	assert(t, ok && 1 == tracker.Counters, "alert policy counter is restored")
+
+	ClearIncident("state-component")
+	assert(t, 1 == len(sink.resolved) && "ref-state-component" == sink.resolved[0], "restored incident is resolved")
+	assert(t, 0 == len(closed.resolved), "incident closed on the sink is not resolved again")
+	ClearIncident("state-component2")
+}
+
+func TestDebouncedStateSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor-state")
+	errNil(t, err)
+	defer os.RemoveAll(dir)
+
+	GetConfig().StateFilePath = filepath.Join(dir, "state.json")
+	defer func() { GetConfig().StateFilePath = "" }()
+	saved := stateSaveDelay
+	stateSaveDelay = time.Hour
+	defer func() { stateSaveDelay = saved }()
+
+	policy := AlertPolicyCfg{Ceiling: 5}
+	ReportIncident("debounced-component", "debounced-component", "message", "description", &policy)
+	defer ClearIncident("debounced-component")
+	_, err = os.Stat(GetConfig().StateFilePath)
+	assert(t, os.IsNotExist(err), "the alert policy counters are not written on every probe run")
+
+	flushState()
+	buf, err := ioutil.ReadFile(GetConfig().StateFilePath)
+	errNil(t, err)
+	assert(t, strings.Contains(string(buf), "debounced-component"), "the pending changes are written on flush")
+
+	errNil(t, os.Remove(GetConfig().StateFilePath))
+	flushState()
+	_, err = os.Stat(GetConfig().StateFilePath)
+	assert(t, os.IsNotExist(err), "nothing is written without a change")
+}
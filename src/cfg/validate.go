@@ -0,0 +1,501 @@
+package cfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/kafkaesque-io/pulsar-monitor/src/schedule"
+	"github.com/kafkaesque-io/pulsar-monitor/src/stats"
+	"github.com/kafkaesque-io/pulsar-monitor/src/util"
+)
+
+// strict validation of the configuration, every problem is reported with its path in the configuration file
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ConfigError is a configuration problem at a path, i.e. pulsarTopicConfig[0].pulsarUrl
+type ConfigError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ConfigError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ConfigErrors is a list of configuration problems
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d configuration problem(s) found", len(e)))
+	for _, v := range e {
+		lines = append(lines, "  "+v.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type validator struct {
+	errs ConfigErrors
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields reports the keys of a decoded JSON document that do not match any field of the type
+// The field names are matched case insensitively as encoding/json does.
+func (v *validator) unknownFields(path string, doc interface{}, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fieldType, ok := fields[strings.ToLower(k)]
+			if !ok {
+				v.add(joinPath(path, k), "unknown field")
+				continue
+			}
+			v.unknownFields(joinPath(path, k), obj[k], fieldType)
+		}
+	case reflect.Map:
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for k, value := range obj {
+			v.unknownFields(joinPath(path, k), value, t.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := doc.([]interface{})
+		if !ok {
+			return
+		}
+		for i, value := range list {
+			v.unknownFields(indexPath(path, i), value, t.Elem())
+		}
+	}
+}
+
+// jsonFields returns the field types of a struct keyed by the lower case JSON name
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			}
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && name == f.Name {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
+}
+
+// url validates an url has a host and one of the schemes
+func (v *validator) url(path, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil {
+		v.add(path, "malformed url %q, %v", value, err)
+		return
+	}
+	if !util.StrContains(schemes, u.Scheme) {
+		v.add(path, "url %q must have one of the schemes %s", value, strings.Join(schemes, ", "))
+		return
+	}
+	if u.Host == "" {
+		v.add(path, "url %q has no host", value)
+	}
+}
+
+func (v *validator) required(path, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(path, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) nonNegative(path string, value int) {
+	if value < 0 {
+		v.add(path, "must not be negative")
+	}
+}
+
+// alertPolicy flags the policies that can never fire for a probe running at the interval
+func (v *validator) alertPolicy(path string, p AlertPolicyCfg, interval time.Duration) {
+	v.nonNegative(joinPath(path, "ceiling"), p.Ceiling)
+	v.nonNegative(joinPath(path, "movingWindowSeconds"), p.MovingWindowSeconds)
+	v.nonNegative(joinPath(path, "ceilingInMovingWindow"), p.CeilingInMovingWindow)
+	v.nonNegative(joinPath(path, "recoveryCount"), p.RecoveryCount)
+	v.nonNegative(joinPath(path, "recoverySeconds"), p.RecoverySeconds)
+	v.nonNegative(joinPath(path, "flapWindowSeconds"), p.FlapWindowSeconds)
+	v.nonNegative(joinPath(path, "flapThreshold"), p.FlapThreshold)
+
+	if p.Ceiling <= 0 {
+		// a policy without ceiling is not evaluated, it is fine as long as nothing else is configured
+		if p.MovingWindowSeconds > 0 || p.CeilingInMovingWindow > 0 || p.RecoveryCount > 0 ||
+			p.RecoverySeconds > 0 || p.FlapThreshold > 0 {
+			v.add(joinPath(path, "ceiling"), "the alert policy can never fire, it is only evaluated with a positive ceiling")
+		}
+		return
+	}
+
+	window := util.TimeDuration(p.MovingWindowSeconds, 1, time.Second)
+	if p.CeilingInMovingWindow > 1 && window <= time.Duration(p.CeilingInMovingWindow-1)*interval {
+		v.add(joinPath(path, "ceilingInMovingWindow"),
+			"%d failures can never occur within the %v moving window at the probe interval %v",
+			p.CeilingInMovingWindow, window, interval)
+	}
+
+	switch {
+	case p.FlapThreshold == 1:
+		v.add(joinPath(path, "flapThreshold"), "must be at least 2, every incident would be flapping")
+	case p.FlapThreshold > 1:
+		// an incident transition requires at least one probe run
+		flapWindow := util.TimeDuration(p.FlapWindowSeconds, 1800, time.Second)
+		if flapWindow <= time.Duration(p.FlapThreshold-1)*interval {
+			v.add(joinPath(path, "flapThreshold"),
+				"%d transitions can never occur within the %v flap window at the probe interval %v",
+				p.FlapThreshold, flapWindow, interval)
+		}
+	}
+}
+
+func (v *validator) topic(path string, t TopicCfg) {
+	if v.required(joinPath(path, "pulsarUrl"), t.PulsarURL) {
+		v.url(joinPath(path, "pulsarUrl"), t.PulsarURL, "pulsar", "pulsar+ssl")
+	}
+	if t.AdminURL != "" {
+		v.url(joinPath(path, "adminUrl"), t.AdminURL, "http", "https")
+	}
+	v.required(joinPath(path, "topicName"), t.TopicName)
+	for i, size := range t.PayloadSizes {
+		if _, err := ParsePayloadSize(size); err != nil {
+			v.add(indexPath(joinPath(path, "payloadSizes"), i), "%v", err)
+		}
+	}
+	v.nonNegative(joinPath(path, "numberOfPartitions"), t.NumberOfPartitions)
+	v.nonNegative(joinPath(path, "latencyBudgetMs"), t.LatencyBudgetMs)
+	v.nonNegative(joinPath(path, "intervalSeconds"), t.IntervalSeconds)
+	v.nonNegative(joinPath(path, "timeoutSeconds"), t.TimeoutSeconds)
+	v.nonNegative(joinPath(path, "numberOfMessages"), t.NumOfMessages)
+	if p := t.LatencyBudgetPercentile; p != "" && p != meanLatency && !util.StrContains(percentileNames, p) {
+		v.add(joinPath(path, "latencyBudgetPercentile"), "must be one of %s, %s", meanLatency, strings.Join(percentileNames, ", "))
+	}
+	v.alertPolicy(joinPath(path, "alertPolicy"), t.AlertPolicy, util.TimeDuration(t.IntervalSeconds, 60, time.Second))
+	v.probeSchedule(path, t.ProbeScheduleCfg)
+	v.anomalyDetector(joinPath(path, "anomalyDetector"), t.AnomalyDetector)
+}
+
+func (v *validator) webSocket(path string, w WsConfig) {
+	v.required(joinPath(path, "name"), w.Name)
+	// an url that does not start with ws is replaced by the one built from the cluster, port and topic
+	generated := false
+	checkURL := func(key, value string) {
+		switch {
+		case strings.HasPrefix(value, "ws"):
+			v.url(joinPath(path, key), value, "ws", "wss")
+		case value != "":
+			v.add(joinPath(path, key), "url %q must have one of the schemes ws, wss", value)
+		default:
+			generated = true
+		}
+	}
+	checkURL("producerUrl", w.ProducerURL)
+	checkURL("consumerUrl", w.ConsumerURL)
+	if generated {
+		v.required(joinPath(path, "cluster"), w.Cluster)
+		v.required(joinPath(path, "topicName"), w.TopicName)
+		if w.Scheme != "ws://" && w.Scheme != "wss://" {
+			v.add(joinPath(path, "scheme"), "%q must be ws:// or wss://", w.Scheme)
+		}
+	}
+	v.nonNegative(joinPath(path, "latencyBudgetMs"), w.LatencyBudgetMs)
+	v.nonNegative(joinPath(path, "intervalSeconds"), w.IntervalSeconds)
+	v.nonNegative(joinPath(path, "timeoutSeconds"), w.TimeoutSeconds)
+	v.alertPolicy(joinPath(path, "alertPolicy"), w.AlertPolicy, util.TimeDuration(w.IntervalSeconds, 60, time.Second))
+	v.probeSchedule(path, w.ProbeScheduleCfg)
+	v.anomalyDetector(joinPath(path, "anomalyDetector"), w.AnomalyDetector)
+}
+
+func (v *validator) anomalyDetector(path string, c AnomalyDetectorCfg) {
+	if c.Type != "" && !util.StrContains(stats.DetectorTypes, strings.ToLower(c.Type)) {
+		v.add(joinPath(path, "type"), "must be one of %s", strings.Join(stats.DetectorTypes, ", "))
+	}
+	if c.Threshold < 0 {
+		v.add(joinPath(path, "threshold"), "must not be negative")
+	}
+	if c.Alpha < 0 || c.Alpha > 1 {
+		v.add(joinPath(path, "alpha"), "must be between 0 and 1")
+	}
+	v.nonNegative(joinPath(path, "windowSize"), c.WindowSize)
+	v.nonNegative(joinPath(path, "minSamples"), c.MinSamples)
+	if c.WindowSize > 0 && c.MinSamples > c.WindowSize {
+		v.add(joinPath(path, "minSamples"), "must not exceed the window size")
+	}
+}
+
+func (v *validator) site(path string, s SiteCfg) {
+	v.required(joinPath(path, "name"), s.Name)
+	if v.required(joinPath(path, "url"), s.URL) {
+		v.url(joinPath(path, "url"), s.URL, "http", "https")
+	}
+	if s.StatusCodeExpr != "" {
+		env := map[string]interface{}{"statusCode": 200}
+		if _, err := expr.Compile(s.StatusCodeExpr, expr.Env(env), expr.AsBool()); err != nil {
+			v.add(joinPath(path, "statusCodeExpr"), "invalid expression %q, %v", s.StatusCodeExpr, err)
+		}
+	}
+	v.nonNegative(joinPath(path, "intervalSeconds"), s.IntervalSeconds)
+	v.nonNegative(joinPath(path, "timeoutSeconds"), s.TimeoutSeconds)
+	v.nonNegative(joinPath(path, "responseSeconds"), s.ResponseSeconds)
+	v.nonNegative(joinPath(path, "retries"), s.Retries)
+	v.alertPolicy(joinPath(path, "alertPolicy"), s.AlertPolicy, util.TimeDuration(s.IntervalSeconds, 120, time.Second))
+	v.probeSchedule(path, s.ProbeScheduleCfg)
+}
+
+// metricLabels validates the static metric labels do not collide with the labels of the metrics
+func (v *validator) metricLabels(path string, labels map[string]string) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__"):
+			v.add(joinPath(path, name), "invalid Prometheus label name")
+		case util.StrContains(probeLabelNames, name):
+			v.add(joinPath(path, name), "label is reserved for the probe metrics")
+		}
+	}
+}
+
+// probeSchedule validates the cron schedule and the active hours of a probe
+func (v *validator) probeSchedule(path string, c ProbeScheduleCfg) {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		v.add(joinPath(path, "timezone"), "%v", err)
+		return
+	}
+	if c.Schedule != "" {
+		if _, err := schedule.ParseInLocation(c.Schedule, loc); err != nil {
+			v.add(joinPath(path, "schedule"), "%v", err)
+		}
+	}
+	for i, r := range c.ActiveHours {
+		if _, err := schedule.ParseHoursInLocation([]string{r}, loc); err != nil {
+			v.add(indexPath(joinPath(path, "activeHours"), i), "%v", err)
+		}
+	}
+}
+
+// ValidateConfig checks the values of a configuration, it returns every problem found
+func ValidateConfig(c *Configuration) ConfigErrors {
+	v := &validator{}
+	v.required("name", c.Name)
+
+	// the default probe name of a topic test is its cluster host name, the tests of a cluster need their own names
+	defaultNames := make(map[string]int)
+	for _, t := range c.PulsarTopicConfig {
+		if t.Name == "" {
+			defaultNames[topicProbeName(t)]++
+		}
+	}
+	// the probes are identified by type and name, the path of the probe name is keyed by the probe id
+	probeNames := make(map[string]string)
+	uniqueName := func(path, probeType, name string) {
+		if first, ok := probeNames[probeID(probeType, name)]; ok {
+			v.add(path, "duplicate %s probe name %s, it is the name of %s", probeType, name, first)
+		} else if name != "" {
+			probeNames[probeID(probeType, name)] = path
+		}
+	}
+	for i, t := range c.PulsarTopicConfig {
+		path := indexPath("pulsarTopicConfig", i)
+		v.topic(path, t)
+		if name := topicProbeName(t); t.Name == "" && defaultNames[name] > 1 {
+			v.add(joinPath(path, "name"), "is required when several topic tests run on the cluster %s", name)
+		} else {
+			uniqueName(joinPath(path, "name"), topicProbeType(t), name)
+		}
+	}
+	for i, w := range c.WebSocketConfig {
+		path := indexPath("webSocketConfig", i)
+		v.webSocket(path, w)
+		uniqueName(joinPath(path, "name"), ProbeTypeWebSocket, w.Name)
+	}
+	for i, s := range c.SitesConfig.Sites {
+		path := indexPath("sitesConfig.sites", i)
+		v.site(path, s)
+		uniqueName(joinPath(path, "name"), ProbeTypeSite, s.Name)
+	}
+
+	tenantsInterval := util.TimeDuration(c.PulsarAdminConfig.IntervalSeconds, 120, time.Second)
+	v.nonNegative("pulsarAdminRestConfig.timeoutSeconds", c.PulsarAdminConfig.TimeoutSeconds)
+	for i, cluster := range c.PulsarAdminConfig.Clusters {
+		path := indexPath("pulsarAdminRestConfig.clusters", i)
+		if v.required(joinPath(path, "name"), cluster.Name) {
+			uniqueName(joinPath(path, "name"), ProbeTypeTenants, cluster.Name)
+		}
+		if v.required(joinPath(path, "url"), cluster.URL) {
+			v.url(joinPath(path, "url"), cluster.URL, "http", "https")
+		}
+		v.alertPolicy(joinPath(path, "alertPolicy"), cluster.AlertPolicy, tenantsInterval)
+	}
+
+	if c.BrokersConfig.InClusterRESTURL != "" {
+		v.url("brokersConfig.inclusterRestURL", c.BrokersConfig.InClusterRESTURL, "http", "https")
+		v.nonNegative("brokersConfig.timeoutSeconds", c.BrokersConfig.TimeoutSeconds)
+		v.alertPolicy("brokersConfig.alertPolicy", c.BrokersConfig.AlertPolicy,
+			util.TimeDuration(c.BrokersConfig.IntervalSeconds, 60, time.Second))
+	}
+	v.metricLabels("prometheusConfig.labels", c.PrometheusConfig.Labels)
+	for i, bound := range c.PrometheusConfig.LatencyBucketsMs {
+		if bound <= 0 {
+			v.add(indexPath("prometheusConfig.latencyBucketsMs", i), "must be positive")
+		} else if i > 0 && bound <= c.PrometheusConfig.LatencyBucketsMs[i-1] {
+			v.add(indexPath("prometheusConfig.latencyBucketsMs", i), "must be greater than the previous bucket")
+		}
+	}
+	if rw := c.PrometheusConfig.RemoteWrite; rw.URL != "" {
+		v.url("prometheusConfig.remoteWrite.url", rw.URL, "http", "https")
+		v.nonNegative("prometheusConfig.remoteWrite.intervalSeconds", rw.IntervalSeconds)
+		v.nonNegative("prometheusConfig.remoteWrite.timeoutSeconds", rw.TimeoutSeconds)
+		v.nonNegative("prometheusConfig.remoteWrite.batchSize", rw.BatchSize)
+		if rw.Retries != nil {
+			v.nonNegative("prometheusConfig.remoteWrite.retries", *rw.Retries)
+		}
+		v.metricLabels("prometheusConfig.remoteWrite.externalLabels", rw.ExternalLabels)
+	}
+	if c.OTLPConfig.Endpoint != "" {
+		v.url("otlpConfig.endpoint", c.OTLPConfig.Endpoint, "http", "https")
+		v.nonNegative("otlpConfig.intervalSeconds", c.OTLPConfig.IntervalSeconds)
+		v.nonNegative("otlpConfig.timeoutSeconds", c.OTLPConfig.TimeoutSeconds)
+	}
+	lw := c.LatencyWindowConfig
+	v.nonNegative("latencyWindowConfig.size", lw.Size)
+	v.nonNegative("latencyWindowConfig.minSamples", lw.MinSamples)
+	v.nonNegative("latencyWindowConfig.halfLifeSeconds", lw.HalfLifeSeconds)
+	windowSize := lw.Size
+	if windowSize <= 0 {
+		windowSize = stats.DefaultWindowSize
+	}
+	if lw.MinSamples > windowSize {
+		v.add("latencyWindowConfig.minSamples", "must not exceed the window size")
+	}
+	v.nonNegative("schedulerConfig.startupJitterSeconds", c.SchedulerConfig.StartupJitterSeconds)
+	v.nonNegative("schedulerConfig.staggerSeconds", c.SchedulerConfig.StaggerSeconds)
+	if c.SchedulerConfig.JitterPercent < 0 || c.SchedulerConfig.JitterPercent > 100 {
+		v.add("schedulerConfig.jitterPercent", "must be between 0 and 100")
+	}
+
+	if c.K8sConfig.Enabled {
+		v.alertPolicy("k8sConfig.alertPolicy", c.K8sConfig.AlertPolicy, clusterMonInterval)
+	}
+	if c.PagerDutyConfig.EventsURL != "" {
+		v.url("pagerDutyConfig.eventsUrl", c.PagerDutyConfig.EventsURL, "http", "https")
+	}
+
+	sinkFactoriesLock.RLock()
+	for i, name := range c.AlertSinks {
+		if _, ok := sinkFactories[name]; !ok {
+			v.add(indexPath("alertSinks", i), "unknown alert sink %s", name)
+		}
+	}
+	sinkFactoriesLock.RUnlock()
+
+	for i, s := range c.Silences {
+		path := indexPath("silences", i)
+		if err := s.Matchers.validate(); err != nil {
+			v.add(joinPath(path, "matchers"), "%v", err)
+		}
+		// a silence without an end time would never expire, as over the admin API it is rejected
+		if s.EndsAt.IsZero() {
+			v.add(joinPath(path, "endsAt"), "is required")
+		} else if !s.StartsAt.IsZero() && !s.EndsAt.After(s.StartsAt) {
+			v.add(joinPath(path, "endsAt"), "must be after the start time %v", s.StartsAt)
+		}
+	}
+	for i, w := range c.MaintenanceWindows {
+		path := indexPath("maintenanceWindows", i)
+		if err := w.Matchers.validate(); err != nil {
+			v.add(joinPath(path, "matchers"), "%v", err)
+		}
+		if v.required(joinPath(path, "schedule"), w.Schedule) {
+			if loc, err := time.LoadLocation(w.Timezone); err != nil {
+				v.add(joinPath(path, "timezone"), "%v", err)
+			} else if _, err := schedule.ParseInLocation(w.Schedule, loc); err != nil {
+				v.add(joinPath(path, "schedule"), "%v", err)
+			}
+		}
+		if w.DurationMinutes <= 0 {
+			v.add(joinPath(path, "durationMinutes"), "must be positive")
+		}
+	}
+	return v.errs
+}
+
+// checkUnknownFields reports the keys in a JSON configuration document that do not match any configuration field
+func checkUnknownFields(jsonBytes []byte) ConfigErrors {
+	var doc interface{}
+	if err := json.Unmarshal(jsonBytes, &doc); err != nil {
+		return ConfigErrors{{Message: err.Error()}}
+	}
+	v := &validator{}
+	v.unknownFields("", doc, reflect.TypeOf(Configuration{}))
+	return v.errs
+}
@@ -0,0 +1,188 @@
+package cfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTempConfig(tb testing.TB, name, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	errNil(tb, err)
+	file := filepath.Join(dir, name)
+	errNil(tb, ioutil.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+func hasConfigError(errs ConfigErrors, path, msg string) bool {
+	for _, e := range errs {
+		if e.Path == path && strings.Contains(e.Message, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConfigTemplates(t *testing.T) {
+	for _, file := range []string{
+		"../../config/runtime-template.json",
+		"../../config/runtime-template.yml",
+		"../../config/runtime-single-cluster-standalone.yml",
+	} {
+		_, err := LoadConfigFile(file)
+		assert(t, err == nil, "template %s is valid %v", file, err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	file := writeTempConfig(t, "runtime.yml", `
+name: test
+prometheusConfig:
+  labels:
+    region: us-east-1
+    topic: test
+    1st: invalid
+  latencyBucketsMs: [10, 5, 100]
+pulsarOpsConfig:
+  intervalSeconds: 120
+latencyWindowConfig:
+  size: 5
+  minSamples: 10
+pulsarTopicConfig:
+  - pulsarUrl: localhost:6650
+    adminUrl: "http://"
+    topicName: persistent://public/default/test
+    payloadSizes: ["10KB", "1.5MB", "20GB"]
+    latencyBudgetPercentile: p42
+    anomalyDetector:
+      type: zscore
+      alpha: 1.5
+    alertPolicy:
+      ceiling: 3
+      movingWindowSeconds: 60
+      ceilingInMovingWindow: 5
+      celing: 5
+  - pulsarUrl: pulsar+ssl://broker.example.com:6651
+    topicName: persistent://public/default/test
+    intervalSeconds: 10
+    schedule: "@hourly"
+    anomalyDetector:
+      type: Seasonal
+      windowSize: 48
+      minSamples: 12
+    alertPolicy:
+      movingWindowSeconds: 60
+      ceilingInMovingWindow: 5
+  - pulsarUrl: pulsar+ssl://broker.example.com:6651
+    topicName: persistent://public/default/other
+  - name: named-topic
+    pulsarUrl: pulsar+ssl://broker.example.com:6651
+    topicName: persistent://public/default/named
+webSocketConfig:
+  - name: ws
+    producerUrl: http://broker.example.com/ws/v2/producer/persistent/public/default/test
+    cluster: broker.example.com
+    topicName: persistent/public/default/test
+    scheme: "wss://"
+    activeHours: ["22:00-06:00", "9-17"]
+sitesConfig:
+  sites:
+    - name: site
+      url: https://example.com
+      timezone: Mars/Olympus_Mons
+      statusCodeExpr: "statusCode >"
+      alertPolicy:
+        ceiling: 1
+        flapThreshold: 1
+    - name: named-topic
+      url: https://example.com
+    - name: site
+      url: https://example.com
+maintenanceWindows:
+  - schedule: "0 25 * * *"
+    durationMinutes: 30
+    matchers:
+      component: "*"
+silences:
+  - matchers:
+      component: "*"
+  - startsAt: "2026-01-02T00:00:00Z"
+    endsAt: "2026-01-01T00:00:00Z"
+    matchers:
+      component: "*"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	c, err := LoadConfigFile(file)
+	errs, ok := err.(ConfigErrors)
+	assert(t, ok, "validation errors are returned %v", err)
+	assert(t, "test" == c.Name, "the parsed configuration is returned along with the errors")
+
+	assert(t, hasConfigError(errs, "pulsarOpsConfig", "unknown field"), "unknown top level field")
+	assert(t, !hasConfigError(errs, "prometheusConfig.labels.region", ""), "valid static label")
+	assert(t, hasConfigError(errs, "prometheusConfig.labels.topic", "reserved"), "static label collides with a probe label")
+	assert(t, hasConfigError(errs, "prometheusConfig.labels.1st", "invalid Prometheus label name"), "invalid static label name")
+	assert(t, hasConfigError(errs, "prometheusConfig.latencyBucketsMs[1]", "greater than the previous"), "latency buckets out of order")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].alertPolicy.celing", "unknown field"), "unknown nested field")
+	assert(t, !hasConfigError(errs, "pulsarTopicConfig[0].alertPolicy.ceiling", "unknown field"), "field names are case insensitive")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].pulsarUrl", "schemes pulsar, pulsar+ssl"), "pulsarUrl without scheme")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].adminUrl", "no host"), "adminUrl without host")
+	assert(t, !hasConfigError(errs, "pulsarTopicConfig[0].payloadSizes[0]", ""), "valid payload size")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].payloadSizes[1]", "invalid payload size"), "fractional payload size")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].payloadSizes[2]", "unknown unit"), "unknown payload unit")
+	assert(t, hasConfigError(errs, "latencyWindowConfig.minSamples", "must not exceed the window size"), "minimum samples over the window size")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].anomalyDetector.type", "must be one of"), "unknown anomaly detector")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].anomalyDetector.alpha", "between 0 and 1"), "ewma smoothing factor")
+	assert(t, !hasConfigError(errs, "pulsarTopicConfig[1].anomalyDetector.type", ""), "valid anomaly detector")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].latencyBudgetPercentile", "must be one of"), "unknown latency budget percentile")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[0].alertPolicy.ceilingInMovingWindow", "can never occur"), "moving window shorter than the failures")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[1].alertPolicy.ceiling", "can never fire"), "moving window without ceiling")
+	assert(t, hasConfigError(errs, "webSocketConfig[0].producerUrl", "schemes ws, wss"), "websocket url scheme")
+	assert(t, hasConfigError(errs, "sitesConfig.sites[0].statusCodeExpr", "invalid expression"), "status code expression")
+	assert(t, !hasConfigError(errs, "pulsarTopicConfig[1].schedule", ""), "valid probe schedule")
+	assert(t, !hasConfigError(errs, "webSocketConfig[0].activeHours[0]", ""), "valid active hours")
+	assert(t, hasConfigError(errs, "webSocketConfig[0].activeHours[1]", "invalid time of day"), "invalid active hours")
+	assert(t, hasConfigError(errs, "sitesConfig.sites[0].timezone", "unknown time zone"), "invalid probe schedule time zone")
+	assert(t, hasConfigError(errs, "sitesConfig.sites[0].alertPolicy.flapThreshold", "at least 2"), "flap threshold")
+	assert(t, hasConfigError(errs, "maintenanceWindows[0].schedule", ""), "cron schedule")
+	assert(t, hasConfigError(errs, "pulsarTopicConfig[2].name", "several topic tests run on the cluster broker.example.com"),
+		"the topic tests of a cluster need their own names")
+	assert(t, !hasConfigError(errs, "pulsarTopicConfig[3].name", ""), "a named topic test on the same cluster")
+	assert(t, !hasConfigError(errs, "sitesConfig.sites[1].name", ""), "the probes of different types may have the name")
+	assert(t, hasConfigError(errs, "sitesConfig.sites[2].name", "duplicate site probe name site, it is the name of sitesConfig.sites[0].name"),
+		"the probe names are unique within a probe type")
+	assert(t, hasConfigError(errs, "silences[0].endsAt", "is required"), "silence without an end time")
+	assert(t, hasConfigError(errs, "silences[1].endsAt", "after the start time"), "silence ending before it starts")
+	assert(t, strings.Contains(err.Error(), "pulsarTopicConfig[0].pulsarUrl: "), "every problem is reported with its path")
+}
+
+func TestLoadConfigFileSyntaxError(t *testing.T) {
+	file := writeTempConfig(t, "runtime.json", `{"name": "test", "pulsarTopicConfig": {}}`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	_, err := LoadConfigFile(file)
+	assert(t, err != nil, "type mismatch is an error")
+	_, ok := err.(ConfigErrors)
+	assert(t, !ok, "parse error is not a validation error")
+
+	_, err = LoadConfigFile(filepath.Join(filepath.Dir(file), "missing.yml"))
+	assert(t, err != nil, "missing file is an error")
+}
+
+func TestParsePayloadSize(t *testing.T) {
+	size, err := ParsePayloadSize("200B")
+	assert(t, err == nil && 200 == size, "bytes")
+	size, err = ParsePayloadSize("12")
+	assert(t, err == nil && 12 == size, "default unit is byte")
+	size, err = ParsePayloadSize(" 2 kb")
+	assert(t, err == nil && 2048 == size, "kilobytes")
+	size, err = ParsePayloadSize("1MB")
+	assert(t, err == nil && 1024*1024 == size, "megabytes")
+	_, err = ParsePayloadSize("MB")
+	assert(t, err != nil, "missing number")
+	_, err = ParsePayloadSize("1TB")
+	assert(t, err != nil, "unknown unit")
+	assert(t, 1024 == NumOfBytes("1KB"), "NumOfBytes is unchanged")
+}
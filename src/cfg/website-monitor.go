@@ -1,6 +1,7 @@
 package cfg
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,10 +9,14 @@ import (
 
 	"github.com/antonmedv/expr"
 	"github.com/hashicorp/go-retryablehttp"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 )
 
-func monitorSite(site SiteCfg) error {
+// monitorSite is traced with the span of the request, the traceparent header propagates the trace to the site
+func monitorSite(ctx context.Context, site SiteCfg) (err error) {
+	ctx, span := otlp.Start(ctx, "site check", otlp.String("http.url", site.URL))
+	defer func() { span.EndWithError(err) }()
 
 	client := retryablehttp.NewClient()
 	client.HTTPClient.Timeout = time.Duration(site.ResponseSeconds) * time.Second
@@ -21,25 +26,30 @@ func monitorSite(site SiteCfg) error {
 
 	req, err := retryablehttp.NewRequest(http.MethodGet, site.URL, nil)
 	if err != nil {
-		return err
+		return probeError(reasonInvalidConfig, err)
 	}
+	req = req.WithContext(ctx)
 
 	for k, v := range site.Headers {
 		req.Header.Add(k, v)
 	}
 
+	_, requestSpan := otlp.Start(ctx, "request")
+	req.Header.Set("traceparent", requestSpan.TraceParent())
 	sentTime := time.Now()
 	resp, err := client.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
+		requestSpan.SetAttributes(otlp.Int("http.status_code", resp.StatusCode))
 	}
+	requestSpan.EndWithError(err)
 	if err != nil {
-		return err
+		return probeError(reasonConnect, err)
 	}
-	PromLatencySum(SiteLatencyGaugeOpt(), site.Name, time.Now().Sub(sentTime))
+	PromProbeLatency(ctx, SiteLatencyGaugeOpt(), ProbeLabels{Device: site.Name, Probe: site.Name, Type: ProbeTypeSite}, time.Now().Sub(sentTime))
 
 	if site.StatusCode > 0 && resp.StatusCode != site.StatusCode {
-		return fmt.Errorf("Response statusCode %d does not match the expected code %d", resp.StatusCode, site.StatusCode)
+		return probeError(reasonHTTPStatus, fmt.Errorf("Response statusCode %d does not match the expected code %d", resp.StatusCode, site.StatusCode))
 	}
 
 	if site.StatusCodeExpr != "" {
@@ -50,24 +60,27 @@ func monitorSite(site SiteCfg) error {
 
 		result, err := expr.Eval(site.StatusCodeExpr, env)
 		if err != nil {
-			return fmt.Errorf("Response code %d does not satisfy expression evaluation %s, error %v",
-				resp.StatusCode, site.StatusCodeExpr, err)
+			return probeError(reasonExpr, fmt.Errorf("Response code %d does not satisfy expression evaluation %s, error %v",
+				resp.StatusCode, site.StatusCodeExpr, err))
 		}
 		rc, ok := result.(bool)
 		if !ok {
-			return fmt.Errorf("Response code %d evaluation against %s failed to reach a boolean verdict",
-				resp.StatusCode, site.StatusCodeExpr)
+			return probeError(reasonExpr, fmt.Errorf("Response code %d evaluation against %s failed to reach a boolean verdict",
+				resp.StatusCode, site.StatusCodeExpr))
 		} else if !rc {
-			return fmt.Errorf("Response code %d evaluation againt %s failed",
-				resp.StatusCode, site.StatusCodeExpr)
+			return probeError(reasonExpr, fmt.Errorf("Response code %d evaluation againt %s failed",
+				resp.StatusCode, site.StatusCodeExpr))
 		}
 	}
 
 	return nil
 }
 
-func mon(site SiteCfg) {
-	err := monitorSite(site)
+func mon(ctx context.Context, site SiteCfg) {
+	registerProbeComponent(site.Name, site.Name, ProbeTypeSite)
+	start := time.Now()
+	err := monitorSite(ctx, site)
+	recordProbeResult(site.Name, ProbeTypeSite, time.Since(start), err)
 	if err != nil {
 		errMsg := fmt.Sprintf("site monitoring %s error: %v", site.URL, err)
 		title := fmt.Sprintf("persisted %s endpoint failure", site.Name)
@@ -80,21 +93,26 @@ func mon(site SiteCfg) {
 
 // MonitorSites monitors a list of sites
 func MonitorSites() {
-	sites := GetConfig().SitesConfig.Sites
-	log.Println(sites)
+	log.Println(GetConfig().SitesConfig.Sites)
+	scheduleProbes(registerProbes(siteProbes()))
+}
 
-	for _, site := range sites {
-		log.Println(site.URL)
-		go func(s SiteCfg) {
-			interval := util.TimeDuration(s.IntervalSeconds, 120, time.Second)
-			ticker := time.NewTicker(interval)
-			mon(s)
-			for {
-				select {
-				case <-ticker.C:
-					mon(s)
-				}
-			}
-		}(site)
+// siteProbes returns the unregistered probes of the configured sites
+func siteProbes() []*Probe {
+	list := []*Probe{}
+	for _, site := range GetConfig().SitesConfig.Sites {
+		s := site
+		log.Println(s.URL)
+		p := &Probe{
+			Name:        s.Name,
+			Type:        ProbeTypeSite,
+			Component:   s.Name,
+			Interval:    util.TimeDuration(s.IntervalSeconds, 120, time.Second),
+			Timeout:     time.Duration(s.TimeoutSeconds) * time.Second,
+			fingerprint: probeFingerprint(s),
+			run:         func(ctx context.Context) { mon(ctx, s) },
+		}
+		list = append(list, p.withSchedule(s.ProbeScheduleCfg))
 	}
+	return list
 }
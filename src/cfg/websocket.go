@@ -1,7 +1,9 @@
 package cfg
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/gorilla/websocket"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 )
 
@@ -62,7 +65,14 @@ func tokenAsURLQueryParam(url, token string) string {
 }
 
 // WsLatencyTest latency test for websocket
-func WsLatencyTest(producerURL, subscriptionURL, token string) (MsgResult, error) {
+// It waits for the message until the context is done, 30 seconds if the context has no deadline.
+// The run is traced with the spans of the producer connect, subscribe, send, receive and ack.
+func WsLatencyTest(ctx context.Context, producerURL, subscriptionURL, token string) (result MsgResult, err error) {
+	ctx, cancel := util.WithDefaultTimeout(ctx, 30*time.Second)
+	defer cancel()
+	ctx, span := otlp.Start(ctx, "websocket latency")
+	defer func() { span.EndWithError(err) }()
+
 	wsHeaders := http.Header{}
 	if token != "" {
 		bearerToken := "Bearer " + token
@@ -72,15 +82,19 @@ func WsLatencyTest(producerURL, subscriptionURL, token string) (MsgResult, error
 	subsURL := tokenAsURLQueryParam(subscriptionURL, token)
 
 	// log.Infof("wss producer connection url %s\n\t\tconsumer url %s\n", prodURL, subsURL)
-	prodConn, _, err := websocket.DefaultDialer.Dial(prodURL, wsHeaders)
+	_, connectSpan := otlp.Start(ctx, "connect")
+	prodConn, _, err := websocket.DefaultDialer.DialContext(ctx, prodURL, wsHeaders)
+	connectSpan.EndWithError(err)
 	if err != nil {
-		return MsgResult{Latency: failedLatency}, err
+		return MsgResult{Latency: failedLatency}, probeError(reasonConnect, err)
 	}
 	defer prodConn.Close()
 
-	consConn, _, err := websocket.DefaultDialer.Dial(subsURL, wsHeaders)
+	_, subscribeSpan := otlp.Start(ctx, "subscribe")
+	consConn, _, err := websocket.DefaultDialer.DialContext(ctx, subsURL, wsHeaders)
+	subscribeSpan.EndWithError(err)
 	if err != nil {
-		return MsgResult{Latency: failedLatency}, err
+		return MsgResult{Latency: failedLatency}, probeError(reasonSubscribe, err)
 	}
 	defer consConn.Close()
 
@@ -104,21 +118,26 @@ func WsLatencyTest(producerURL, subscriptionURL, token string) (MsgResult, error
 
 		for wait := true; wait; {
 			var msg ReceivingMessage
+			_, receiveSpan := otlp.Start(ctx, "receive")
 			err := consConn.ReadJSON(&msg)
+			receiveSpan.EndWithError(err)
 			if err != nil {
 				log.Infof("ws consumer read error: %v", err)
-				errChan <- err
+				errChan <- probeError(reasonReceive, err)
 				return
 			}
 			decoded, err := base64.StdEncoding.DecodeString(msg.Payload)
 			if err != nil {
 				log.Infof("ws consumer decode error: %v", err)
-				errChan <- err
+				errChan <- probeError(reasonInvalidResponse, err)
 				return
 			}
 			decodedStr := string(decoded)
 			actMsg := &AckMessage{MessageID: msg.MessageID}
-			if err = consConn.WriteJSON(actMsg); err != nil {
+			_, ackSpan := otlp.Start(ctx, "ack")
+			err = consConn.WriteJSON(actMsg)
+			ackSpan.EndWithError(err)
+			if err != nil {
 				log.Infof("ws consumer failed to ack message %s", err.Error())
 				errChan <- err
 				return
@@ -147,14 +166,17 @@ func WsLatencyTest(producerURL, subscriptionURL, token string) (MsgResult, error
 	}()
 
 	encodedText := base64.StdEncoding.EncodeToString([]byte(messageText))
-	message := &PulsarMessage{Payload: encodedText}
+	// the traceparent property correlates the message with the broker and the consumer side traces
+	_, sendSpan := otlp.Start(ctx, "send")
+	message := &PulsarMessage{Payload: encodedText, Properties: map[string]interface{}{"traceparent": sendSpan.TraceParent()}}
 
 	// for mesaure latency
 	sentTime := time.Now()
 
 	err = prodConn.WriteJSON(message)
+	sendSpan.EndWithError(err)
 	if err != nil {
-		return MsgResult{Latency: failedLatency}, err
+		return MsgResult{Latency: failedLatency}, probeError(reasonSend, err)
 	}
 
 	for {
@@ -164,33 +186,40 @@ func WsLatencyTest(producerURL, subscriptionURL, token string) (MsgResult, error
 		case err := <-errChan:
 			log.Errorf("websocket error: %v", err)
 			return MsgResult{Latency: failedLatency}, err
-		case <-time.After(30 * time.Second):
-			return MsgResult{Latency: failedLatency}, fmt.Errorf("timed out without receiving the expect message")
+		case <-ctx.Done():
+			return MsgResult{Latency: failedLatency}, probeError(reasonReceiveTimeout, fmt.Errorf("timed out without receiving the expect message"))
 		}
 	}
 }
 
 // TestWsLatency test all clusters' websocket pub sub latency
-func TestWsLatency(config WsConfig) {
+// The run is cancelled when the context is done.
+func TestWsLatency(ctx context.Context, config WsConfig) {
 	token := util.AssignString(config.Token, GetConfig().Token)
 	expectedLatency := util.TimeDuration(config.LatencyBudgetMs, 2*latencyBudget, time.Millisecond)
 
-	stdVerdict := util.GetStdBucket(config.Cluster)
+	detectorKey := probeID(ProbeTypeWebSocket, config.Name)
+	registerProbeComponent(config.Name, config.Cluster, ProbeTypeWebSocket)
 
-	result, err := WsLatencyTest(config.ProducerURL, config.ConsumerURL, token)
+	// the message is expected within 30 seconds unless the timeout is configured
+	ctx, cancel := context.WithTimeout(ctx, util.TimeDuration(config.TimeoutSeconds, 30, time.Second))
+	defer cancel()
+	result, err := WsLatencyTest(ctx, config.ProducerURL, config.ConsumerURL, token)
+	probeErr := err
 	if err != nil {
 		errMsg := fmt.Sprintf("cluster %s, %s websocket latency test Pulsar error: %v", config.Cluster, config.Name, err)
 		VerboseAlert(config.Name+"-websocket-err", errMsg, 3*time.Minute)
 	} else if result.Latency > expectedLatency {
-		stdVerdict.Add(float64(result.Latency.Milliseconds()))
+		addLatency(detectorKey, config.AnomalyDetector, config.Timezone, result.Latency)
 		errMsg := fmt.Sprintf("cluster %s, %s websocket test message latency %v over the budget %v",
 			config.Cluster, config.Name, result.Latency, expectedLatency)
+		probeErr = probeError(reasonOverBudget, errors.New(errMsg))
 		VerboseAlert(config.Name+"-websocket-latency", errMsg, 3*time.Minute)
 		ReportIncident(config.Name, config.Cluster, "websocket persisted latency test failure", errMsg, &config.AlertPolicy)
-	} else if stddev, mean, within3Sigma := stdVerdict.Push(float64(result.Latency.Milliseconds())); !within3Sigma {
-		errMsg := fmt.Sprintf("cluster %s, websocket test message latency %v over three standard deviation %v ms and mean is %v ms",
-			config.Cluster, result.Latency, stddev, mean)
-		VerboseAlert(config.Name+"-websocket-stddev", errMsg, 10*time.Minute)
+	} else if anomaly := latencyAnomaly(detectorKey, config.AnomalyDetector, config.Timezone, result.Latency); anomaly != nil {
+		errMsg := fmt.Sprintf("cluster %s, websocket test message %v", config.Cluster, anomaly)
+		probeErr = probeError(reasonStddevAnomaly, errors.New(errMsg))
+		VerboseAlert(config.Name+"-websocket-anomaly", errMsg, 10*time.Minute)
 		ReportIncident(config.Name, config.Cluster, "websocket persisted latency test failure", errMsg, &config.AlertPolicy)
 
 	} else {
@@ -199,24 +228,38 @@ func TestWsLatency(config WsConfig) {
 		ClearIncident(config.Name)
 	}
 
-	PromLatencySum(GetGaugeType(websocketSubsystem), config.Cluster, result.Latency)
+	recordProbeResult(config.Name, ProbeTypeWebSocket, result.Latency, probeErr)
+	if result.Latency < failedLatency {
+		PromProbeLatency(ctx, GetGaugeType(websocketSubsystem), ProbeLabels{
+			Device: config.Cluster,
+			Probe:  config.Name,
+			Type:   ProbeTypeWebSocket,
+			Topic:  config.TopicName,
+		}, result.Latency)
+	}
 }
 
 // WebSocketTopicLatencyTestThread tests a message websocket delivery in topic and measure the latency.
 func WebSocketTopicLatencyTestThread() {
-	configs := GetConfig().WebSocketConfig
-
-	for _, cfg := range configs {
-		cfg.reconcileConfig()
-		go func(t WsConfig) {
-			ticker := time.NewTicker(util.TimeDuration(t.IntervalSeconds, 60, time.Second))
-			TestWsLatency(t)
-			for {
-				select {
-				case <-ticker.C:
-					TestWsLatency(t)
-				}
-			}
-		}(cfg)
+	scheduleProbes(registerProbes(webSocketProbes()))
+}
+
+// webSocketProbes returns the unregistered probes of the configured websocket tests
+func webSocketProbes() []*Probe {
+	list := []*Probe{}
+	for _, cfg := range GetConfig().WebSocketConfig {
+		t := cfg
+		t.reconcileConfig()
+		p := &Probe{
+			Name:        t.Name,
+			Type:        ProbeTypeWebSocket,
+			Component:   t.Name,
+			Interval:    util.TimeDuration(t.IntervalSeconds, 60, time.Second),
+			Timeout:     time.Duration(t.TimeoutSeconds) * time.Second,
+			fingerprint: probeFingerprint(t),
+			run:         func(ctx context.Context) { TestWsLatency(ctx, t) },
+		}
+		list = append(list, p.withSchedule(t.ProbeScheduleCfg))
 	}
+	return list
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kafkaesque-io/pulsar-monitor/src/cfg"
+)
+
+// exit codes of the subcommands
+const (
+	exitOK = 0
+	// at least one probe failed
+	exitUnhealthy = 1
+	// invalid command line arguments, the same as the flag package
+	exitUsage = 2
+	// the configuration file cannot be loaded or has problems
+	exitInvalidConfig = 3
+)
+
+type subcommand func(configFile string, args []string) int
+
+var subcommands = map[string]subcommand{
+	"validate": validateCommand,
+	"once":     onceCommand,
+}
+
+const usageText = `Usage: %s [-config file] [command] [-config file] [-output table|json]
+
+Commands:
+  (none)     run the monitor daemon
+  validate   load and validate the configuration file
+  once       run every configured probe a single time and report the results
+
+Exit codes of validate and once:
+  0  the configuration is valid and every probe is healthy
+  1  at least one probe failed
+  2  invalid command line arguments
+  3  the configuration file cannot be loaded or has problems
+
+Options:
+`
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), usageText, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// subcommandFlags parses the flags shared by the subcommands, they follow the subcommand name
+// The -config flag after the subcommand takes precedence over the one before it.
+func subcommandFlags(name, configFile string, args []string) (format, file string, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&format, "output", "table", "report format, table or json")
+	fs.StringVar(&file, "config", configFile, "config file for monitoring")
+	if err := fs.Parse(args); err != nil {
+		return "", "", err
+	}
+	if format != "table" && format != "json" {
+		fs.Usage()
+		return "", "", fmt.Errorf("unsupported output format %s", format)
+	}
+	return format, file, nil
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+type validateReport struct {
+	File     string           `json:"file"`
+	Valid    bool             `json:"valid"`
+	Error    string           `json:"error,omitempty"`
+	Problems cfg.ConfigErrors `json:"problems,omitempty"`
+}
+
+func loadConfig(configFile string) validateReport {
+	report := validateReport{File: configFile, Valid: true}
+	_, err := cfg.LoadConfigFile(configFile)
+	switch e := err.(type) {
+	case nil:
+	case cfg.ConfigErrors:
+		report.Valid = false
+		report.Problems = e
+	default:
+		report.Valid = false
+		report.Error = err.Error()
+	}
+	return report
+}
+
+func printValidateReport(w io.Writer, format string, report validateReport) {
+	if format == "json" {
+		writeJSON(w, report)
+		return
+	}
+	switch {
+	case report.Error != "":
+		fmt.Fprintf(w, "%s is invalid: %s\n", report.File, report.Error)
+	case !report.Valid:
+		fmt.Fprintf(w, "%s has %d problem(s)\n", report.File, len(report.Problems))
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PATH\tPROBLEM")
+		for _, p := range report.Problems {
+			fmt.Fprintf(tw, "%s\t%s\n", p.Path, p.Message)
+		}
+		tw.Flush()
+	default:
+		fmt.Fprintf(w, "%s is valid\n", report.File)
+	}
+}
+
+// validateCommand loads and validates the configuration file
+func validateCommand(configFile string, args []string) int {
+	format, configFile, err := subcommandFlags("validate", configFile, args)
+	if err != nil {
+		return exitUsage
+	}
+	report := loadConfig(configFile)
+	printValidateReport(os.Stdout, format, report)
+	if !report.Valid {
+		return exitInvalidConfig
+	}
+	return exitOK
+}
+
+type onceReport struct {
+	Name    string            `json:"name"`
+	Healthy bool              `json:"healthy"`
+	Probes  []cfg.ProbeStatus `json:"probes"`
+}
+
+func newOnceReport(name string, results []cfg.ProbeStatus) onceReport {
+	report := onceReport{Name: name, Healthy: true, Probes: results}
+	for i, r := range report.Probes {
+		if r.Runs == 0 {
+			report.Probes[i].Error = "the probe did not report a result"
+		}
+		report.Healthy = report.Healthy && r.Healthy
+	}
+	return report
+}
+
+func printOnceReport(w io.Writer, format string, report onceReport) {
+	if format == "json" {
+		writeJSON(w, report)
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROBE\tTYPE\tSTATUS\tLATENCY\tERROR")
+	for _, p := range report.Probes {
+		status := "healthy"
+		if !p.Healthy {
+			status = "failed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.1f ms\t%s\n", p.Name, p.Type, status, p.LatencyMs, p.Error)
+	}
+	tw.Flush()
+	if report.Healthy {
+		fmt.Fprintf(w, "%s: all %d probe(s) are healthy\n", report.Name, len(report.Probes))
+	} else {
+		fmt.Fprintf(w, "%s: at least one probe failed\n", report.Name)
+	}
+}
+
+// onceCommand runs every configured probe a single time and reports the overall health
+func onceCommand(configFile string, args []string) int {
+	format, configFile, err := subcommandFlags("once", configFile, args)
+	if err != nil {
+		return exitUsage
+	}
+	if err := cfg.ReadConfigFile(configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration file %s\n%v\n", configFile, err)
+		return exitInvalidConfig
+	}
+
+	// a one shot run only reports the probe results, it does not persist the incident state or send analytics
+	config := cfg.GetConfig()
+	config.StateFilePath = ""
+	config.AnalyticsConfig = cfg.AnalyticsCfg{}
+
+	report := newOnceReport(config.Name, cfg.RunProbesOnce())
+	printOnceReport(os.Stdout, format, report)
+	if !report.Healthy {
+		return exitUnhealthy
+	}
+	return exitOK
+}
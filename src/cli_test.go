@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestSubcommandFlags(t *testing.T) {
+	format, file, err := subcommandFlags("validate", "runtime.yml", []string{"-config", "f.yaml", "-output", "json"})
+	if err != nil || "json" != format || "f.yaml" != file {
+		t.Fatalf("the flags after the subcommand are parsed, %s %s %v", format, file, err)
+	}
+
+	format, file, err = subcommandFlags("once", "runtime.yml", nil)
+	if err != nil || "table" != format || "runtime.yml" != file {
+		t.Fatalf("the config file before the subcommand is the default, %s %s %v", format, file, err)
+	}
+
+	if _, _, err = subcommandFlags("validate", "runtime.yml", []string{"-output", "xml"}); err == nil {
+		t.Fatal("an unsupported output format is rejected")
+	}
+}
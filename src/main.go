@@ -1,68 +1,124 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/google/gops/agent"
 	"github.com/kafkaesque-io/pulsar-monitor/src/cfg"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
 	cfgFile = flag.String("config", "../config/runtime.yml", "config file for monitoring")
 )
 
-type complete struct{} //emptry struct as a single for channel
+// the interval to check the configuration file for changes
+const configWatchInterval = 10 * time.Second
+
+// the maximum time to wait for each shutdown step
+const shutdownTimeout = 30 * time.Second
 
 func main() {
 	// runtime.GOMAXPROCS does not the container's CPU quota in Kubernetes
 	// therefore, it requires to be set explicitly
 	runtime.GOMAXPROCS(util.StrToInt(os.Getenv("GOMAXPROCS"), 1))
 
+	flag.Usage = usage
+	flag.Parse()
+	effectiveCfgFile := util.AssignString(os.Getenv("PULSAR_OPS_MONITOR_CFG"), *cfgFile)
+	log.Infof("config file %s", effectiveCfgFile)
+
+	// any other positional argument is ignored by the daemon
+	if command, ok := subcommands[flag.Arg(0)]; ok {
+		os.Exit(command(effectiveCfgFile, flag.Args()[1:]))
+	}
+
 	// gops debug instrument
 	if err := agent.Listen(agent.Options{}); err != nil {
 		panic(fmt.Sprintf("gops instrument error %v", err))
 	}
 
-	flag.Parse()
-	effectiveCfgFile := util.AssignString(os.Getenv("PULSAR_OPS_MONITOR_CFG"), *cfgFile)
-	log.Infof("config file %s", effectiveCfgFile)
-	cfg.ReadConfigFile(effectiveCfgFile)
+	if err := cfg.ReadConfigFile(effectiveCfgFile); err != nil {
+		log.Fatalf("invalid configuration file %s\n%v", effectiveCfgFile, err)
+	}
 
-	exit := make(chan *complete)
 	config := cfg.GetConfig()
 
+	// the scheduler owns every probe and periodic task, it stops on SIGTERM
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler := cfg.NewScheduler(ctx)
+	cfg.SetScheduler(scheduler)
+
 	cfg.SetupAnalytics()
+	cfg.SetupAlertSinks()
+	cfg.OTLPExportThread()
+	if err := cfg.LoadState(); err != nil {
+		log.Errorf("failed to restore incident state %v", err)
+	}
 
 	cfg.AnalyticsAppStart(util.AssignString(config.Name, "dev"))
 	cfg.MonitorK8sPulsarCluster()
 	cfg.MonitorBrokers()
-	cfg.RunInterval(cfg.PulsarTenants, util.TimeDuration(config.PulsarAdminConfig.IntervalSeconds, 120, time.Second))
+	cfg.MonitorTenants()
 	cfg.RunInterval(cfg.StartHeartBeat, util.TimeDuration(config.OpsGenieConfig.IntervalSeconds, 240, time.Second))
 	cfg.RunInterval(cfg.UptimeHeartBeat, 30*time.Second) // fixed 30 seconds for heartbeat
 	cfg.MonitorSites()
 	cfg.TopicLatencyTestThread()
 	cfg.WebSocketTopicLatencyTestThread()
-	cfg.PushToPrometheusProxyThread()
+	cfg.RemoteWriteThread()
 	// Disable tenant usage metering, this is not a monitoring function
 	// BuildTenantsUsageThread()
 
+	// reload the configuration on change of the file or on SIGHUP
+	cfg.WatchConfigFile(effectiveCfgFile, configWatchInterval)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Infof("reload configuration file %s on SIGHUP", effectiveCfgFile)
+			cfg.ReloadConfigFile(effectiveCfgFile)
+		}
+	}()
+
+	var server *http.Server
 	if config.PrometheusConfig.ExposeMetrics {
 		log.Infof("start to listen to http port %s", config.PrometheusConfig.Port)
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(util.AssignString(config.PrometheusConfig.Port, ":8089"), nil)
+		http.Handle("/metrics", cfg.MetricsHandler())
+		cfg.RegisterAdminAPI(http.DefaultServeMux)
+		cfg.RegisterDashboard(http.DefaultServeMux)
+		server = &http.Server{Addr: util.AssignString(config.PrometheusConfig.Port, ":8089")}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				log.Errorf("http server error %v", err)
+			}
+		}()
+	}
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, os.Interrupt)
+	sig := <-term
+	log.Infof("received %v, shutting down", sig)
+
+	// stop ticking and wait for the in-flight probes
+	cancel()
+	if !scheduler.Wait(shutdownTimeout) {
+		log.Warnf("in-flight probes are not completed within %v", shutdownTimeout)
 	}
-	for {
-		select {
-		case <-exit:
-			os.Exit(2)
+	if server != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("http server shutdown error %v", err)
 		}
 	}
+	cfg.Shutdown(shutdownTimeout)
 }
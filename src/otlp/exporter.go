@@ -0,0 +1,450 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ServiceName is the service.name resource attribute of the exported signals
+	ServiceName = "pulsar-monitor"
+	// DurationMetric is the cumulative histogram of the span durations in milliseconds
+	// There is a data point per probe, stage and status, the stage is the span name.
+	DurationMetric = "pulsar.probe.duration"
+
+	defaultMaxQueueSize = 10000
+)
+
+// DefaultBoundsMs are the explicit bounds of the duration histogram buckets in milliseconds
+var DefaultBoundsMs = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// the root span attributes of the duration histogram, the other attributes such as the run id are per run
+var metricAttributeKeys = []string{"probe.name", "probe.type"}
+
+// Config is the OTLP/HTTP exporter configuration
+type Config struct {
+	// Endpoint is the base url of the collector, the signals are posted to /v1/traces and /v1/metrics
+	Endpoint           string
+	Headers            map[string]string
+	ResourceAttributes map[string]string
+	Timeout            time.Duration
+	// MaxQueueSize is the maximum spans queued between the flushes, the oldest are dropped beyond it
+	MaxQueueSize int
+	// BoundsMs are the explicit bounds of the duration histogram, DefaultBoundsMs by default
+	BoundsMs []float64
+}
+
+// Exporter queues the ended spans, aggregates their durations and posts them in the OTLP JSON encoding
+type Exporter struct {
+	endpoint string
+	headers  map[string]string
+	resource []Attribute
+	client   *http.Client
+	maxQueue int
+	bounds   []float64
+
+	lock    sync.Mutex
+	spans   []spanData
+	dropped int
+	// series are the cumulative duration histograms by the key of their attributes
+	series map[string]*histogramSeries
+}
+
+// spanData is the snapshot of an ended span
+type spanData struct {
+	name                    string
+	traceID, spanID, parent string
+	start, end              time.Time
+	attrs                   []Attribute
+	failed                  bool
+	status                  string
+}
+
+// histogramSeries is the cumulative duration histogram of a probe stage since the first span
+// The latest span since the last flush is the exemplar.
+type histogramSeries struct {
+	attrs    []Attribute
+	start    time.Time
+	count    uint64
+	sum      float64
+	buckets  []uint64
+	exemplar *exemplarData
+}
+
+type exemplarData struct {
+	at              time.Time
+	valueMs         float64
+	traceID, spanID string
+}
+
+var (
+	exporterLock   sync.RWMutex
+	globalExporter *Exporter
+)
+
+// SetExporter sets the exporter of the spans started afterwards, nil disables the export
+func SetExporter(e *Exporter) {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+	globalExporter = e
+}
+
+// GetExporter returns the exporter of the spans, nil if the export is disabled
+func GetExporter() *Exporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+	return globalExporter
+}
+
+// NewExporter creates an exporter to the collector endpoint
+func NewExporter(c Config) *Exporter {
+	e := &Exporter{
+		endpoint: strings.TrimSuffix(c.Endpoint, "/"),
+		headers:  c.Headers,
+		resource: []Attribute{String("service.name", ServiceName)},
+		client:   &http.Client{Timeout: c.Timeout},
+		maxQueue: c.MaxQueueSize,
+		bounds:   c.BoundsMs,
+		series:   map[string]*histogramSeries{},
+	}
+	if len(e.bounds) == 0 {
+		e.bounds = DefaultBoundsMs
+	}
+	if e.client.Timeout <= 0 {
+		e.client.Timeout = 10 * time.Second
+	}
+	if e.maxQueue <= 0 {
+		e.maxQueue = defaultMaxQueueSize
+	}
+	keys := make([]string, 0, len(c.ResourceAttributes))
+	for k := range c.ResourceAttributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.resource = append(e.resource, String(k, c.ResourceAttributes[k]))
+	}
+	return e
+}
+
+// record queues the ended span and observes its duration
+// The histogram has the probe attributes of the root span, the stage of the span name and the status.
+func (e *Exporter) record(s *Span) {
+	data := spanData{
+		name:    s.name,
+		traceID: s.TraceID(),
+		spanID:  s.SpanID(),
+		start:   s.start,
+		attrs:   s.attributes(),
+	}
+	var zero [8]byte
+	if s.parentID != zero {
+		data.parent = fmt.Sprintf("%x", s.parentID[:])
+	}
+	s.lock.Lock()
+	data.end, data.failed, data.status = s.end, s.failed, s.status
+	s.lock.Unlock()
+
+	status := "ok"
+	if data.failed {
+		status = "error"
+	}
+	attrs := []Attribute{}
+	for _, a := range s.root.attributes() {
+		for _, key := range metricAttributeKeys {
+			if a.Key == key {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+	attrs = append(attrs, String("stage", s.name), String("status", status))
+	valueMs := float64(data.end.Sub(data.start)) / float64(time.Millisecond)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.observe(attrs, valueMs, &exemplarData{at: data.end, valueMs: valueMs, traceID: data.traceID, spanID: data.spanID})
+	e.spans = append(e.spans, data)
+	if over := len(e.spans) - e.maxQueue; over > 0 {
+		e.spans = e.spans[over:]
+		e.dropped += over
+	}
+}
+
+// observe adds the duration to the histogram of the attributes, it must be called with the lock
+func (e *Exporter) observe(attrs []Attribute, valueMs float64, exemplar *exemplarData) {
+	key := seriesKey(attrs)
+	h, ok := e.series[key]
+	if !ok {
+		h = &histogramSeries{attrs: attrs, start: exemplar.at, buckets: make([]uint64, len(e.bounds)+1)}
+		e.series[key] = h
+	}
+	// a bucket counts the values greater than the previous bound up to its bound
+	h.buckets[sort.SearchFloat64s(e.bounds, valueMs)]++
+	h.count++
+	h.sum += valueMs
+	h.exemplar = exemplar
+}
+
+func seriesKey(attrs []Attribute) string {
+	var sb strings.Builder
+	for _, a := range attrs {
+		fmt.Fprintf(&sb, "%s=%v\x00", a.Key, a.Value)
+	}
+	return sb.String()
+}
+
+// Flush posts the queued spans and the cumulative histograms
+// The spans are dropped if the collector fails to accept them, the histograms are posted again on the next flush.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.lock.Lock()
+	spans, dropped := e.spans, e.dropped
+	e.spans, e.dropped = nil, 0
+	metrics := e.metrics(time.Now())
+	e.lock.Unlock()
+
+	if len(spans) > 0 {
+		if err := e.post(ctx, "/v1/traces", e.traces(spans)); err != nil {
+			return err
+		}
+	}
+	if metrics != nil {
+		if err := e.post(ctx, "/v1/metrics", metrics); err != nil {
+			return err
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%d spans were dropped since the queue was full", dropped)
+	}
+	return nil
+}
+
+func (e *Exporter) post(ctx context.Context, path string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp export to %s error %v", req.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("otlp export to %s error status code %d %s", req.URL, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// the OTLP JSON encoding of the collector requests, the ids are hex encoded
+// and the 64 bit integers are strings as the proto3 JSON mapping
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type tracesRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type exemplar struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+	TraceID      string  `json:"traceId"`
+	SpanID       string  `json:"spanId"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+	Exemplars         []exemplar `json:"exemplars,omitempty"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type metric struct {
+	Name      string    `json:"name"`
+	Unit      string    `json:"unit"`
+	Histogram histogram `json:"histogram"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type metricsRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+// the span kind and the status codes of the OTLP trace, and the cumulative aggregation temporality
+const (
+	spanKindInternal      = 1
+	statusCodeOk          = 1
+	statusCodeError       = 2
+	temporalityCumulative = 2
+)
+
+func (e *Exporter) traces(spans []spanData) *tracesRequest {
+	ss := scopeSpans{Scope: scope{Name: ServiceName}}
+	for _, s := range spans {
+		st := status{Code: statusCodeOk}
+		if s.failed {
+			st = status{Code: statusCodeError, Message: s.status}
+		}
+		ss.Spans = append(ss.Spans, span{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parent,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        keyValues(s.attrs),
+			Status:            st,
+		})
+	}
+	return &tracesRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: keyValues(e.resource)},
+		ScopeSpans: []scopeSpans{ss},
+	}}}
+}
+
+// metrics returns the histograms at the time and resets their exemplars, nil without histograms
+// It must be called with the lock.
+func (e *Exporter) metrics(now time.Time) *metricsRequest {
+	if len(e.series) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(e.series))
+	for k := range e.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	m := metric{Name: DurationMetric, Unit: "ms", Histogram: histogram{AggregationTemporality: temporalityCumulative}}
+	for _, k := range keys {
+		h := e.series[k]
+		p := histogramDataPoint{
+			Attributes:        keyValues(h.attrs),
+			StartTimeUnixNano: unixNano(h.start),
+			TimeUnixNano:      unixNano(now),
+			Count:             strconv.FormatUint(h.count, 10),
+			Sum:               h.sum,
+			ExplicitBounds:    e.bounds,
+		}
+		for _, c := range h.buckets {
+			p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(c, 10))
+		}
+		if x := h.exemplar; x != nil {
+			p.Exemplars = []exemplar{{TimeUnixNano: unixNano(x.at), AsDouble: x.valueMs, TraceID: x.traceID, SpanID: x.spanID}}
+			h.exemplar = nil
+		}
+		m.Histogram.DataPoints = append(m.Histogram.DataPoints, p)
+	}
+
+	return &metricsRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     resource{Attributes: keyValues(e.resource)},
+		ScopeMetrics: []scopeMetrics{{Scope: scope{Name: ServiceName}, Metrics: []metric{m}}},
+	}}}
+}
+
+func keyValues(attrs []Attribute) []keyValue {
+	kvs := make([]keyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v anyValue
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &value
+		case bool:
+			v.BoolValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, keyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,181 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// collector is an in-process stand-in of an OTLP/HTTP collector
+type collector struct {
+	lock    sync.Mutex
+	traces  []tracesRequest
+	metrics []metricsRequest
+	headers http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.headers = r.Header
+	var err error
+	switch r.URL.Path {
+	case "/v1/traces":
+		var req tracesRequest
+		err = json.NewDecoder(r.Body).Decode(&req)
+		c.traces = append(c.traces, req)
+	case "/v1/metrics":
+		var req metricsRequest
+		err = json.NewDecoder(r.Body).Decode(&req)
+		c.metrics = append(c.metrics, req)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func attribute(kvs []keyValue, key string) string {
+	for _, kv := range kvs {
+		if kv.Key == key && kv.Value.StringValue != nil {
+			return *kv.Value.StringValue
+		}
+	}
+	return ""
+}
+
+func TestExportTrace(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	e := NewExporter(Config{
+		Endpoint:           server.URL + "/",
+		Headers:            map[string]string{"Authorization": "Bearer secret"},
+		ResourceAttributes: map[string]string{"service.instance.id": "monitor-1"},
+	})
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "pubsub", String("probe.name", "topic-a"), String("run.id", "run-1"))
+	_, connect := Start(ctx, "connect")
+	connect.End()
+	_, receive := Start(ctx, "receive", Int("message.index", 1))
+	receive.EndWithError(errors.New("receive timeout"))
+	root.End()
+	root.End()
+
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.traces) != 1 || len(c.metrics) != 1 {
+		t.Fatalf("expect a traces and a metrics request, got %d and %d", len(c.traces), len(c.metrics))
+	}
+	if c.headers.Get("Authorization") != "Bearer secret" {
+		t.Fatal("expect the configured headers")
+	}
+
+	rs := c.traces[0].ResourceSpans[0]
+	if attribute(rs.Resource.Attributes, "service.name") != ServiceName || attribute(rs.Resource.Attributes, "service.instance.id") != "monitor-1" {
+		t.Fatalf("unexpected resource attributes %v", rs.Resource.Attributes)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("expect 3 spans, an ended span is exported once, got %d", len(spans))
+	}
+	for _, s := range spans[:2] {
+		if s.TraceID != root.TraceID() || s.ParentSpanID != root.SpanID() {
+			t.Fatalf("expect span %s to be a child of the root", s.Name)
+		}
+	}
+	if spans[2].ParentSpanID != "" || len(spans[2].TraceID) != 32 || len(spans[2].SpanID) != 16 {
+		t.Fatalf("unexpected root span %+v", spans[2])
+	}
+	if spans[1].Status.Code != statusCodeError || spans[1].Status.Message != "receive timeout" || spans[0].Status.Code != statusCodeOk {
+		t.Fatalf("unexpected span status %+v %+v", spans[0].Status, spans[1].Status)
+	}
+	if *spans[1].Attributes[0].Value.IntValue != "1" {
+		t.Fatalf("unexpected int attribute %+v", spans[1].Attributes)
+	}
+
+	m := c.metrics[0].ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	if m.Name != DurationMetric || m.Histogram.AggregationTemporality != temporalityCumulative || len(m.Histogram.DataPoints) != 3 {
+		t.Fatalf("expect a cumulative histogram per stage, got %+v", m)
+	}
+	var p histogramDataPoint
+	for _, dp := range m.Histogram.DataPoints {
+		if attribute(dp.Attributes, "stage") == "receive" {
+			p = dp
+		}
+	}
+	if attribute(p.Attributes, "probe.name") != "topic-a" || attribute(p.Attributes, "status") != "error" || len(p.Attributes) != 3 {
+		t.Fatalf("expect the probe attributes of the root, the stage and the status %v", p.Attributes)
+	}
+	if p.Count != "1" || len(p.BucketCounts) != len(DefaultBoundsMs)+1 || p.BucketCounts[0] != "1" {
+		t.Fatalf("unexpected histogram data point %+v", p)
+	}
+	if p.Exemplars[0].TraceID != root.TraceID() || p.Exemplars[0].SpanID != spans[1].SpanID {
+		t.Fatal("expect the span as the exemplar of the data point")
+	}
+
+	// the histograms are cumulative, they are posted without new spans
+	_, receive = Start(ctx, "receive", Int("message.index", 2))
+	receive.EndWithError(errors.New("receive timeout"))
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush(context.Background()); err != nil || len(c.traces) != 2 || len(c.metrics) != 3 {
+		t.Fatalf("expect no traces request without spans, %d traces and %d metrics requests", len(c.traces), len(c.metrics))
+	}
+	for _, dp := range c.metrics[2].ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Histogram.DataPoints {
+		if attribute(dp.Attributes, "stage") == "receive" && (dp.Count != "2" || dp.StartTimeUnixNano != p.StartTimeUnixNano || len(dp.Exemplars) != 0) {
+			t.Fatalf("expect the cumulative count since the first span without a new exemplar %+v", dp)
+		}
+	}
+}
+
+func TestSpanWithoutExporter(t *testing.T) {
+	ctx, s := Start(context.Background(), "site")
+	if SpanFromContext(ctx) != s {
+		t.Fatal("expect the span in the context")
+	}
+	if !strings.HasPrefix(s.TraceParent(), "00-"+s.TraceID()+"-"+s.SpanID()) {
+		t.Fatalf("unexpected traceparent %s", s.TraceParent())
+	}
+	s.End()
+
+	var nilSpan *Span
+	nilSpan.SetAttributes(String("k", "v"))
+	nilSpan.EndWithError(errors.New("ignored"))
+	if nilSpan.TraceParent() != "" || SpanFromContext(context.Background()) != nil {
+		t.Fatal("expect a nil span to be a no-op")
+	}
+}
+
+func TestExportQueueLimit(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	e := NewExporter(Config{Endpoint: server.URL, MaxQueueSize: 2})
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	for i := 0; i < 3; i++ {
+		_, s := Start(context.Background(), "probe")
+		s.End()
+	}
+	err := e.Flush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "1 spans were dropped") {
+		t.Fatalf("expect the dropped spans to be reported, error %v", err)
+	}
+	if len(c.traces[0].ResourceSpans[0].ScopeSpans[0].Spans) != 2 {
+		t.Fatal("expect the queued spans to be exported")
+	}
+}
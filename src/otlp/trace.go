@@ -0,0 +1,169 @@
+package otlp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Attribute is a key value attribute of a span or a metric data point
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Span is a timed operation of a trace, a span without parent is the root of a new trace
+// The methods are safe to call on a nil span.
+type Span struct {
+	name     string
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	root     *Span
+	exporter *Exporter
+	start    time.Time
+
+	lock   sync.Mutex
+	end    time.Time
+	attrs  []Attribute
+	failed bool
+	status string
+}
+
+type spanKey struct{}
+
+// Start starts a span as the child of the span in the context, or the root of a new trace
+// The span is exported when it ends if an exporter is set.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	s := &Span{
+		name:     name,
+		exporter: GetExporter(),
+		start:    time.Now(),
+		attrs:    append([]Attribute{}, attrs...),
+	}
+	randomBytes(s.spanID[:])
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+		s.root = parent.root
+	} else {
+		randomBytes(s.traceID[:])
+		s.root = s
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFromContext returns the span in the context, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttributes adds the attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// RecordError marks the span as failed with the error, a nil error is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failed = true
+	s.status = err.Error()
+}
+
+// End ends the span and queues it to the exporter, only the first call takes effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if !s.end.IsZero() {
+		s.lock.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.lock.Unlock()
+
+	if s.exporter != nil {
+		s.exporter.record(s)
+	}
+}
+
+// EndWithError records the error, if any, and ends the span
+func (s *Span) EndWithError(err error) {
+	s.RecordError(err)
+	s.End()
+}
+
+// TraceID returns the hex encoded trace id
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SpanID returns the hex encoded span id
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.spanID[:])
+}
+
+// TraceParent returns the W3C traceparent header of the span to propagate the trace,
+// i.e. in the http requests or the message properties
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID(), s.SpanID())
+}
+
+// Duration returns the duration of an ended span
+func (s *Span) Duration() time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.end.Sub(s.start)
+}
+
+func (s *Span) attributes() []Attribute {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Attribute{}, s.attrs...)
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// the ids only need to be unique
+		t := time.Now().UnixNano()
+		for i := range b {
+			b[i] = byte(t >> (8 * uint(i%8)))
+		}
+	}
+}
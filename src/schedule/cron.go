@@ -0,0 +1,213 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a standard five field cron expression parser
+// minute hour day-of-month month day-of-week
+// each field supports *, lists (1,2), ranges (1-5) and steps (*/15, 1-30/5)
+// and the descriptors @hourly, @daily, @midnight, @weekly, @monthly and @yearly
+
+// Cron is a parsed cron schedule
+type Cron struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+	loc    *time.Location
+}
+
+// the longest time span Next searches for a scheduled minute
+const maxScan = 5 * 366 * 24 * time.Hour
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var (
+	fields = []field{
+		{"minute", 0, 59},
+		{"hour", 0, 23},
+		{"day of month", 1, 31},
+		{"month", 1, 12},
+		{"day of week", 0, 7},
+	}
+
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Parse parses a cron expression evaluated in UTC
+func Parse(expr string) (*Cron, error) {
+	return ParseInLocation(expr, time.UTC)
+}
+
+// ParseInLocation parses a cron expression evaluated in the time zone
+func ParseInLocation(expr string, loc *time.Location) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q requires %d fields but has %d", expr, len(fields), len(parts))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q %v", expr, err)
+		}
+		bits[i] = b
+	}
+	// both 0 and 7 are Sunday
+	if bits[4]&(1<<7) > 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return &Cron{
+		expr:   expr,
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDom: strings.HasPrefix(parts[2], "*"),
+		anyDow: strings.HasPrefix(parts[4], "*"),
+		loc:    loc,
+	}, nil
+}
+
+func parseField(part string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rangeStr, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			s, err := strconv.Atoi(item[i+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", item, f.name)
+			}
+			rangeStr, step = item[:i], s
+		}
+
+		start, end := f.min, f.max
+		switch {
+		case rangeStr == "*":
+		case strings.Contains(rangeStr, "-"):
+			bounds := strings.SplitN(rangeStr, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangeStr, f.name)
+			}
+		default:
+			v, err := parseValue(rangeStr, f)
+			if err != nil {
+				return 0, err
+			}
+			start = v
+			if step == 1 {
+				end = v
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, f.name)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d] in %s field", v, f.min, f.max, f.name)
+	}
+	return v, nil
+}
+
+// String returns the original cron expression
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Matches returns true if the minute of the time matches the schedule
+func (c *Cron) Matches(t time.Time) bool {
+	t = t.In(c.loc)
+	return c.minute&(1<<uint(t.Minute())) > 0 &&
+		c.hour&(1<<uint(t.Hour())) > 0 &&
+		c.month&(1<<uint(t.Month())) > 0 &&
+		c.dayMatches(t)
+}
+
+// the cron convention is that either day field matches when both are restricted
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) > 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) > 0
+	if c.anyDom || c.anyDow {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first scheduled minute after the time, it returns zero time if there is none
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxScan)
+	for t.Before(end) {
+		if c.month&(1<<uint(t.Month())) == 0 || !c.dayMatches(t) {
+			// skip to the next day
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) > 0 {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// Active returns the start of the scheduled window that contains the time,
+// a window starts at every scheduled minute and lasts for the duration.
+func (c *Cron) Active(t time.Time, duration time.Duration) (time.Time, bool) {
+	minute := t.Truncate(time.Minute)
+	for d := time.Duration(0); d < duration; d += time.Minute {
+		if start := minute.Add(-d); c.Matches(start) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
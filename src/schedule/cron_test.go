@@ -0,0 +1,56 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronParse(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "*/15 2-4 * * 1-5", "0 0 1,15 * *", "30 22 * * 0,6", "@daily", "@hourly", "@weekly"} {
+		if _, err := Parse(expr); err != nil {
+			t.Fatalf("expect %q to be valid, error %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@often"} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("expect %q to be invalid", expr)
+		}
+	}
+}
+
+func TestCronMatchesAndNext(t *testing.T) {
+	// Saturday and Sunday at 22:30
+	c, err := Parse("30 22 * * 6,7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saturday := time.Date(2020, 10, 17, 22, 30, 0, 0, time.UTC)
+	if !c.Matches(saturday) || c.Matches(saturday.Add(time.Minute)) {
+		t.Fatal("expect to match Saturday 22:30 only")
+	}
+	if c.Matches(saturday.AddDate(0, 0, -1)) {
+		t.Fatal("expect not to match Friday")
+	}
+	if next := c.Next(saturday); !next.Equal(saturday.AddDate(0, 0, 1)) {
+		t.Fatalf("expect next to be Sunday 22:30, got %v", next)
+	}
+	if next := c.Next(saturday.AddDate(0, 0, 1)); !next.Equal(saturday.AddDate(0, 0, 7)) {
+		t.Fatalf("expect next to be the following Saturday, got %v", next)
+	}
+
+	if start, ok := c.Active(saturday.Add(59*time.Minute), time.Hour); !ok || !start.Equal(saturday) {
+		t.Fatal("expect the one hour window to be active")
+	}
+	if _, ok := c.Active(saturday.Add(time.Hour), time.Hour); ok {
+		t.Fatal("expect the one hour window to be over")
+	}
+
+	// either restricted day field matches
+	c, err = Parse("0 0 1 * 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Matches(time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)) || !c.Matches(time.Date(2020, 10, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal("expect to match the first day of month and Monday")
+	}
+}
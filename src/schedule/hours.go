@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hours is a set of time of day ranges, such as 09:00-17:00 or 22:00-06:00 past midnight
+type Hours struct {
+	ranges []hoursRange
+	loc    *time.Location
+}
+
+// in minutes since midnight, the end is exclusive and before the start for a range past midnight
+type hoursRange struct {
+	start, end int
+}
+
+// ParseHours parses time of day ranges evaluated in UTC
+func ParseHours(ranges []string) (*Hours, error) {
+	return ParseHoursInLocation(ranges, time.UTC)
+}
+
+// ParseHoursInLocation parses time of day ranges evaluated in the time zone
+func ParseHoursInLocation(ranges []string, loc *time.Location) (*Hours, error) {
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("active hours require at least one range")
+	}
+	h := &Hours{loc: loc}
+	if h.loc == nil {
+		h.loc = time.UTC
+	}
+	for _, r := range ranges {
+		bounds := strings.Split(strings.TrimSpace(r), "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("hours range %q must be in the form of HH:MM-HH:MM", r)
+		}
+		start, err := parseTimeOfDay(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("hours range %q %v", r, err)
+		}
+		end, err := parseTimeOfDay(bounds[1])
+		if err != nil {
+			return nil, fmt.Errorf("hours range %q %v", r, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("hours range %q is empty", r)
+		}
+		h.ranges = append(h.ranges, hoursRange{start: start, end: end})
+	}
+	return h, nil
+}
+
+// parseTimeOfDay returns the minutes since midnight of HH:MM, 24:00 is the end of the day
+func parseTimeOfDay(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid hour in time of day %q", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute > 0) {
+		return 0, fmt.Errorf("invalid minute in time of day %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains returns true if the time of day is in one of the ranges
+func (h *Hours) Contains(t time.Time) bool {
+	local := t.In(h.loc)
+	minute := local.Hour()*60 + local.Minute()
+	for _, r := range h.ranges {
+		if r.start < r.end {
+			if minute >= r.start && minute < r.end {
+				return true
+			}
+		} else if minute >= r.start || minute < r.end {
+			return true
+		}
+	}
+	return false
+}
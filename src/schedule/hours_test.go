@@ -0,0 +1,51 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHoursParse(t *testing.T) {
+	for _, ranges := range [][]string{{"09:00-17:00"}, {"22:00-06:00"}, {"00:00-24:00"}, {"1:30-2:45", " 20:00-21:00 "}} {
+		if _, err := ParseHours(ranges); err != nil {
+			t.Fatalf("expect %q to be valid, error %v", ranges, err)
+		}
+	}
+	for _, ranges := range [][]string{{}, {"09:00"}, {"9-17"}, {"25:00-26:00"}, {"09:60-10:00"}, {"24:01-01:00"}, {"08:00-08:00"}, {"00:00-24:00", "a-b"}} {
+		if _, err := ParseHours(ranges); err == nil {
+			t.Fatalf("expect %q to be invalid", ranges)
+		}
+	}
+}
+
+func TestHoursContains(t *testing.T) {
+	day := time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC)
+	h, err := ParseHours([]string{"09:00-17:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Contains(day.Add(9*time.Hour)) || !h.Contains(day.Add(17*time.Hour-time.Minute)) {
+		t.Fatal("expect office hours to be active")
+	}
+	if h.Contains(day.Add(17*time.Hour)) || h.Contains(day.Add(8*time.Hour)) {
+		t.Fatal("expect the end of the range to be exclusive")
+	}
+
+	// off-peak past midnight
+	h, err = ParseHours([]string{"22:00-06:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Contains(day.Add(23*time.Hour)) || !h.Contains(day.Add(5*time.Hour)) || h.Contains(day.Add(12*time.Hour)) {
+		t.Fatal("expect the range past midnight to be active at night only")
+	}
+
+	loc := time.FixedZone("UTC-5", -5*3600)
+	h, err = ParseHoursInLocation([]string{"09:00-17:00"}, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Contains(day.Add(14*time.Hour)) || h.Contains(day.Add(9*time.Hour)) {
+		t.Fatal("expect the hours to be evaluated in the time zone")
+	}
+}
@@ -0,0 +1,148 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the types of the anomaly detectors
+const (
+	// DetectorSigma flags a sample over the standard deviations of the mean of a sliding window
+	DetectorSigma = "sigma"
+	// DetectorEWMA flags a sample over the control band of the exponentially weighted moving average and variance
+	DetectorEWMA = "ewma"
+	// DetectorMAD flags a sample over the median absolute deviations of the median of a sliding window
+	DetectorMAD = "mad"
+	// DetectorSeasonal is the median absolute deviation detector of a baseline per hour of the week
+	DetectorSeasonal = "seasonal"
+)
+
+// DetectorTypes are the supported anomaly detector types
+var DetectorTypes = []string{DetectorSigma, DetectorEWMA, DetectorMAD, DetectorSeasonal}
+
+// the default thresholds in deviations of the detectors
+// the 3.5 modified z-score of the median absolute deviation is as recommended by Iglewicz and Hoaglin
+var defaultThresholds = map[string]float64{
+	DetectorSigma:    6,
+	DetectorEWMA:     3,
+	DetectorMAD:      3.5,
+	DetectorSeasonal: 3.5,
+}
+
+const (
+	// DefaultEWMAAlpha is the default smoothing factor of the EWMA detector
+	DefaultEWMAAlpha = 0.1
+	// DefaultSeasonalSlotSize is four weeks of samples at one minute interval in an hour of the week
+	DefaultSeasonalSlotSize = 240
+)
+
+// Detector evaluates the samples against a baseline of the previous samples
+// Only the samples above the baseline are anomalies, a lower latency is never a problem.
+type Detector interface {
+	// Push evaluates the sample taken at the time and adds it to the baseline
+	Push(num float64, at time.Time) Verdict
+	// Add adds a sample to the baseline without evaluation
+	Add(num float64, at time.Time)
+}
+
+// Verdict is the evaluation of a sample
+type Verdict struct {
+	Anomaly bool
+	// Baseline is the expected value, i.e. the mean or the median
+	Baseline float64
+	// Deviation is the estimated standard deviation of the baseline
+	Deviation float64
+	// Score is the number of deviations of the sample above the baseline
+	Score float64
+}
+
+// DetectorOptions configures an anomaly detector
+type DetectorOptions struct {
+	// Type is one of DetectorTypes, sigma by default
+	Type string
+	// Threshold is the score of an anomaly, 6 for sigma, 3 for ewma, and 3.5 for mad and seasonal by default
+	Threshold float64
+	// Alpha is the smoothing factor of ewma in (0, 1], DefaultEWMAAlpha by default
+	Alpha float64
+	// Window is the sliding window of sigma and mad, or the window of every hour of the week of seasonal.
+	// The minimum samples are the warm up of every detector.
+	Window WindowOptions
+	// Location is the time zone of the hours of the week of seasonal, UTC by default
+	Location *time.Location
+}
+
+// NewDetector creates an anomaly detector
+func NewDetector(name string, opts DetectorOptions) (Detector, error) {
+	detectorType := strings.ToLower(opts.Type)
+	if detectorType == "" {
+		detectorType = DetectorSigma
+	}
+	threshold, ok := defaultThresholds[detectorType]
+	if !ok {
+		return nil, fmt.Errorf("unknown anomaly detector type %s, must be one of %s", opts.Type, strings.Join(DetectorTypes, ", "))
+	}
+	if opts.Threshold > 0 {
+		threshold = opts.Threshold
+	}
+	minSamples := opts.Window.MinSamples
+	if minSamples <= 0 {
+		minSamples = DefaultMinSamples
+	}
+
+	switch detectorType {
+	case DetectorEWMA:
+		alpha := opts.Alpha
+		if alpha <= 0 || alpha > 1 {
+			alpha = DefaultEWMAAlpha
+		}
+		return &EWMADetector{alpha: alpha, threshold: threshold, minSamples: minSamples}, nil
+	case DetectorMAD:
+		size := opts.Window.Size
+		if size <= 0 {
+			size = DefaultWindowSize
+		}
+		return &MADDetector{window: NewWindow(size, 0), threshold: threshold, minSamples: minSamples}, nil
+	case DetectorSeasonal:
+		size := opts.Window.Size
+		if size <= 0 {
+			size = DefaultSeasonalSlotSize
+		}
+		loc := opts.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		return &SeasonalDetector{slotSize: size, location: loc, threshold: threshold, minSamples: minSamples}, nil
+	default:
+		return &sigmaDetector{sd: NewWindowedStandardDeviation(name, opts.Window), threshold: threshold}, nil
+	}
+}
+
+// sigmaDetector is the detector of the standard deviation, the sample is a part of its own baseline
+type sigmaDetector struct {
+	sd        *StandardDeviation
+	threshold float64
+}
+
+func (d *sigmaDetector) Push(num float64, at time.Time) Verdict {
+	d.sd.lock.Lock()
+	defer d.sd.lock.Unlock()
+	d.sd.addAt(num, at)
+	return verdict(num, d.sd.Mean, d.sd.Std, d.threshold, d.sd.window.Count() >= d.sd.minSamples)
+}
+
+func (d *sigmaDetector) Add(num float64, at time.Time) {
+	d.sd.lock.Lock()
+	defer d.sd.lock.Unlock()
+	d.sd.addAt(num, at)
+}
+
+// verdict scores the sample, there is no anomaly without samples enough or a deviation
+func verdict(num, baseline, deviation, threshold float64, warm bool) Verdict {
+	v := Verdict{Baseline: baseline, Deviation: deviation}
+	if deviation > 0 {
+		v.Score = (num - baseline) / deviation
+	}
+	v.Anomaly = warm && deviation > 0 && v.Score > threshold
+	return v
+}
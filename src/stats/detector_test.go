@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// jitter is a deterministic noise between -2 and 2
+func jitter(i int) float64 {
+	return float64((i*7)%5 - 2)
+}
+
+func newDetector(t *testing.T, opts DetectorOptions) Detector {
+	d, err := NewDetector("Test", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDetectors(t *testing.T) {
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, detectorType := range DetectorTypes {
+		d := newDetector(t, DetectorOptions{Type: detectorType})
+		fresh := newDetector(t, DetectorOptions{Type: detectorType})
+		fresh.Push(100, start)
+		if v := fresh.Push(1000, start); v.Anomaly {
+			t.Fatalf("%s expects no anomaly without the minimum samples", detectorType)
+		}
+		for i := 0; i < 100; i++ {
+			d.Push(100+jitter(i), start.Add(time.Duration(i)*time.Second))
+		}
+		if v := d.Push(101, start.Add(2*time.Minute)); v.Anomaly {
+			t.Fatalf("%s expects a normal latency within the baseline %+v", detectorType, v)
+		}
+		if v := d.Push(80, start.Add(2*time.Minute)); v.Anomaly {
+			t.Fatalf("%s expects a lower latency not to be an anomaly %+v", detectorType, v)
+		}
+		v := d.Push(200, start.Add(2*time.Minute))
+		if !v.Anomaly || v.Baseline < 95 || v.Baseline > 105 || v.Score <= 0 {
+			t.Fatalf("%s expects a spike over the baseline %+v", detectorType, v)
+		}
+	}
+
+	if _, err := NewDetector("Test", DetectorOptions{Type: "zscore"}); err == nil {
+		t.Fatal("expect an unknown detector type error")
+	}
+}
+
+func TestMADDetectorHeavyTail(t *testing.T) {
+	start := time.Now()
+	mad := newDetector(t, DetectorOptions{Type: DetectorMAD})
+	sigma := newDetector(t, DetectorOptions{Type: DetectorSigma})
+	for i := 0; i < 200; i++ {
+		latency := 100 + jitter(i)
+		// every tenth run hits a slow path, the outliers inflate the σ
+		if i%10 == 0 {
+			latency = 2000
+		}
+		mad.Push(latency, start)
+		sigma.Push(latency, start)
+	}
+	if v := sigma.Push(600, start); v.Anomaly {
+		t.Fatalf("expect the σ inflated by the outliers %+v", v)
+	}
+	if v := mad.Push(600, start); !v.Anomaly || v.Baseline < 99 || v.Baseline > 102 {
+		t.Fatalf("expect the median and the MAD robust to the outliers %+v", v)
+	}
+
+	// the mean absolute deviation is the estimate if most samples are the same
+	constant := newDetector(t, DetectorOptions{Type: DetectorMAD, Window: WindowOptions{MinSamples: 3}})
+	for _, latency := range []float64{2, 2, 3, 2, 3, 2, 2} {
+		constant.Push(latency, start)
+	}
+	if v := constant.Push(3, start); v.Anomaly || v.Deviation <= 0 {
+		t.Fatalf("expect a deviation without the MAD %+v", v)
+	}
+}
+
+func TestEWMADetectorShift(t *testing.T) {
+	start := time.Now()
+	d := newDetector(t, DetectorOptions{Type: DetectorEWMA, Alpha: 0.2})
+	for i := 0; i < 50; i++ {
+		d.Push(100+jitter(i), start)
+	}
+	// a gradual shift moves the average along
+	for i := 0; i < 200; i++ {
+		if v := d.Push(100+float64(i)/4+jitter(i), start); v.Anomaly {
+			t.Fatalf("expect the gradual shift %d not to be an anomaly %+v", i, v)
+		}
+	}
+	if v := d.Push(300, start); !v.Anomaly || v.Baseline < 140 {
+		t.Fatalf("expect a jump over the shifted average %+v", v)
+	}
+}
+
+func TestSeasonalDetector(t *testing.T) {
+	loc := time.FixedZone("EST", -5*3600)
+	d := newDetector(t, DetectorOptions{Type: DetectorSeasonal, Location: loc})
+	// the nightly batch at 2 am local time is slow every day for two weeks
+	monday := time.Date(2020, 6, 1, 0, 0, 0, 0, loc)
+	for day := 0; day < 14; day++ {
+		for hour := 0; hour < 24; hour++ {
+			latency := 100.0
+			if hour == 2 {
+				latency = 500
+			}
+			for i := 0; i < 5; i++ {
+				at := monday.AddDate(0, 0, day).Add(time.Duration(hour)*time.Hour + time.Duration(i)*time.Minute)
+				d.Push(latency+jitter(i+hour), at)
+			}
+		}
+	}
+
+	nightly := time.Date(2020, 6, 15, 2, 30, 0, 0, loc)
+	if v := d.Push(500, nightly); v.Anomaly {
+		t.Fatalf("expect the nightly latency of the hour of the week %+v", v)
+	}
+	if v := d.Push(500, nightly.Add(10*time.Hour)); !v.Anomaly {
+		t.Fatalf("expect the nightly latency at noon to be an anomaly %+v", v)
+	}
+	// the time zone of the probe matters, 2 am in UTC is 9 pm in EST
+	if v := d.Push(500, time.Date(2020, 6, 15, 2, 30, 0, 0, time.UTC)); !v.Anomaly {
+		t.Fatalf("expect the hours of the week in the location %+v", v)
+	}
+}
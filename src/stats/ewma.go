@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// EWMADetector is the control chart of the exponentially weighted moving average and variance
+// A sample is evaluated against the band of the previous samples before it is added, the recent samples weigh
+// more so the baseline follows a gradual shift of the latency while a sudden jump is flagged.
+type EWMADetector struct {
+	alpha      float64
+	threshold  float64
+	minSamples int
+
+	lock     sync.Mutex
+	count    int
+	mean     float64
+	variance float64
+}
+
+// Push evaluates the sample against the control band and adds it to the average
+func (d *EWMADetector) Push(num float64, at time.Time) Verdict {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v := verdict(num, d.mean, math.Sqrt(d.variance), d.threshold, d.count >= d.minSamples)
+	d.add(num)
+	return v
+}
+
+// Add adds the sample to the average without evaluation
+func (d *EWMADetector) Add(num float64, at time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.add(num)
+}
+
+// add is the incremental update of the exponentially weighted mean and variance by Finch
+func (d *EWMADetector) add(num float64) {
+	d.count++
+	if d.count == 1 {
+		d.mean = num
+		return
+	}
+	diff := num - d.mean
+	incr := d.alpha * diff
+	d.mean += incr
+	d.variance = (1 - d.alpha) * (d.variance + diff*incr)
+}
@@ -0,0 +1,116 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// madScale scales the median absolute deviation to the standard deviation of a normal distribution
+	madScale = 1.4826
+	// meanADScale scales the mean absolute deviation to the standard deviation of a normal distribution
+	meanADScale = 1.2533
+	hoursOfWeek = 7 * 24
+)
+
+// MADDetector flags a sample over the median absolute deviations of the median of a sliding window
+// The median and the MAD are not skewed by the outliers of a heavy tailed latency as the mean and σ are.
+type MADDetector struct {
+	threshold  float64
+	minSamples int
+
+	lock   sync.Mutex
+	window *Window
+}
+
+// Push evaluates the sample against the window and adds it to the window
+func (d *MADDetector) Push(num float64, at time.Time) Verdict {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v := robustVerdict(num, d.window, d.threshold, d.minSamples)
+	d.window.Add(num, at)
+	return v
+}
+
+// Add adds the sample to the window without evaluation
+func (d *MADDetector) Add(num float64, at time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.window.Add(num, at)
+}
+
+// SeasonalDetector is the MAD detector with a window for every hour of the week
+// A sample is only compared with the samples of the same hour of the week, so the daily and the weekly
+// cycles of the traffic are not flagged. An hour is not evaluated until it has the minimum samples.
+type SeasonalDetector struct {
+	slotSize   int
+	location   *time.Location
+	threshold  float64
+	minSamples int
+
+	lock  sync.Mutex
+	slots [hoursOfWeek]*Window
+}
+
+// Push evaluates the sample against the window of its hour of the week and adds it to the window
+func (d *SeasonalDetector) Push(num float64, at time.Time) Verdict {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	slot := d.slot(at)
+	v := robustVerdict(num, slot, d.threshold, d.minSamples)
+	slot.Add(num, at)
+	return v
+}
+
+// Add adds the sample to the window of its hour of the week without evaluation
+func (d *SeasonalDetector) Add(num float64, at time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.slot(at).Add(num, at)
+}
+
+// slot returns the window of the hour of the week, it is created on first use
+func (d *SeasonalDetector) slot(at time.Time) *Window {
+	local := at.In(d.location)
+	i := int(local.Weekday())*24 + local.Hour()
+	if d.slots[i] == nil {
+		d.slots[i] = NewWindow(d.slotSize, 0)
+	}
+	return d.slots[i]
+}
+
+func robustVerdict(num float64, w *Window, threshold float64, minSamples int) Verdict {
+	if w.Count() == 0 {
+		return Verdict{}
+	}
+	median, deviation := medianDeviation(w.values())
+	return verdict(num, median, deviation, threshold, w.Count() >= minSamples)
+}
+
+// medianDeviation returns the median and the scaled median absolute deviation, an estimate of σ robust to the outliers
+// The MAD is zero if over half of the samples are the same, the scaled mean absolute deviation is the estimate instead.
+func medianDeviation(values []float64) (median, deviation float64) {
+	median = medianOf(values)
+	absDevs := make([]float64, len(values))
+	var sum float64
+	for i, v := range values {
+		absDevs[i] = math.Abs(v - median)
+		sum += absDevs[i]
+	}
+	if mad := medianOf(absDevs); mad > 0 {
+		return median, madScale * mad
+	}
+	return median, meanADScale * sum / float64(len(values))
+}
+
+// medianOf returns the median, the values are sorted in place
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
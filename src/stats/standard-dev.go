@@ -1,45 +1,91 @@
 package stats
 
-import "math"
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindowSize is a day of samples at one minute interval
+	DefaultWindowSize = 1440
+	// DefaultMinSamples is the minimum samples for the σ evaluation
+	DefaultMinSamples = 10
+)
+
+// WindowOptions configures the samples a standard deviation is calculated over
+type WindowOptions struct {
+	// Size is the maximum number of the latest samples, DefaultWindowSize by default
+	Size int
+	// MinSamples is the number of samples required before a sample can be evaluated as over σ, DefaultMinSamples by default
+	MinSamples int
+	// HalfLife is the time for the weight of a sample to halve, the samples do not decay by default
+	HalfLife time.Duration
+}
 
 // StandardDeviation is the struct to calculate and store standard deviation
-// specifically this is a population standard deviation
+// specifically this is a population standard deviation over a sliding window of the latest samples
 type StandardDeviation struct {
-	Name    string
-	Sum     float64
-	Mean    float64
-	Buckets []float64
-	Std     float64 // σ
+	Name string
+	Mean float64
+	Std  float64 // σ
+
+	lock       sync.Mutex
+	window     *Window
+	minSamples int
 }
 
-// NewStandardDeviation creates a new standard dev object
-func NewStandardDeviation(name string) StandardDeviation {
-	return StandardDeviation{
-		Name: name,
+// NewStandardDeviation creates a new standard dev object over the default window
+func NewStandardDeviation(name string) *StandardDeviation {
+	return NewWindowedStandardDeviation(name, WindowOptions{})
+}
+
+// NewWindowedStandardDeviation creates a new standard dev object over the window
+func NewWindowedStandardDeviation(name string, opts WindowOptions) *StandardDeviation {
+	size, minSamples := opts.Size, opts.MinSamples
+	if size <= 0 {
+		size = DefaultWindowSize
+	}
+	if minSamples <= 0 {
+		minSamples = DefaultMinSamples
+	}
+	return &StandardDeviation{
+		Name:       name,
+		window:     NewWindow(size, opts.HalfLife),
+		minSamples: minSamples,
 	}
 }
 
 // Push a float64 to calculate standard deviation and returns σ and whether the number is over 6σ in positive right side of bell curve
 // 6σ is at odd of every three weeks
 func (sd *StandardDeviation) Push(num float64) (std, mean float64, within6Sigma bool) {
-	sd.Buckets = append(sd.Buckets, num)
-	sd.Sum += num
-	counter := len(sd.Buckets)
-	sd.Mean = sd.Sum / float64(counter)
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	sd.add(num)
 
-	for _, v := range sd.Buckets {
-		std += math.Pow(v-sd.Mean, 2)
-	}
+	// 6σ evaluation only applies to the minimum samples or more
+	return sd.Std, sd.Mean, num-sd.Mean < 6*sd.Std || sd.window.Count() < sd.minSamples
+}
 
-	std = math.Sqrt(std / float64(counter))
-	sd.Std = std
+// Add a float64 sample to the window without evaluation
+func (sd *StandardDeviation) Add(num float64) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	sd.add(num)
+}
 
-	// 6σ evaluation only applies to 10 more data samples
-	return std, sd.Mean, num-sd.Mean < 6*std || counter < 10
+// Count returns the number of samples in the window
+func (sd *StandardDeviation) Count() int {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	return sd.window.Count()
+}
 
+func (sd *StandardDeviation) add(num float64) {
+	sd.addAt(num, time.Now())
 }
 
-// Add a float64 sample to the bucket
-func (sd *StandardDeviation) Add(num float64) {
-	sd.Buckets = append(sd.Buckets, num)
+func (sd *StandardDeviation) addAt(num float64, at time.Time) {
+	sd.window.Add(num, at)
+	sd.Mean = sd.window.Mean()
+	sd.Std = sd.window.StdDev()
 }
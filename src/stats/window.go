@@ -0,0 +1,148 @@
+package stats
+
+import (
+	"math"
+	"time"
+)
+
+// Window is a bounded sliding window of samples with the incremental mean and variance of Welford's algorithm
+// The oldest sample is evicted once the window is full. With a half life, the weight of a sample halves
+// every half life, so the statistics forget the old behaviour even if the samples are sparse.
+type Window struct {
+	size     int
+	halfLife time.Duration
+
+	// samples is a ring buffer, head is the index of the oldest sample
+	samples []sample
+	head    int
+
+	// weight is the sum of the sample weights, m2 is the weighted sum of the squared differences from the mean
+	// both are decayed to the time of the latest sample
+	weight float64
+	mean   float64
+	m2     float64
+	latest time.Time
+}
+
+type sample struct {
+	value float64
+	at    time.Time
+}
+
+// NewWindow creates a window of size samples, the samples do not decay with a zero half life
+func NewWindow(size int, halfLife time.Duration) *Window {
+	if size < 1 {
+		size = 1
+	}
+	return &Window{
+		size:     size,
+		halfLife: halfLife,
+		samples:  make([]sample, 0, size),
+	}
+}
+
+// Add adds a sample taken at the time, the oldest sample is evicted if the window is full
+// Every size evictions the statistics are recomputed from the samples to discard the rounding errors,
+// the cost is O(1) amortized.
+func (w *Window) Add(value float64, at time.Time) {
+	w.decay(at)
+	if len(w.samples) < w.size {
+		w.samples = append(w.samples, sample{value, at})
+		w.include(value, 1)
+		return
+	}
+
+	oldest := w.samples[w.head]
+	w.samples[w.head] = sample{value, at}
+	w.head = (w.head + 1) % w.size
+	if w.head == 0 {
+		w.recompute()
+		return
+	}
+	w.exclude(oldest.value, w.sampleWeight(oldest))
+	w.include(value, 1)
+}
+
+// Count returns the number of samples in the window
+func (w *Window) Count() int {
+	return len(w.samples)
+}
+
+// Mean returns the weighted mean of the samples
+func (w *Window) Mean() float64 {
+	return w.mean
+}
+
+// Variance returns the weighted population variance of the samples
+func (w *Window) Variance() float64 {
+	if w.weight <= 0 {
+		return 0
+	}
+	// the rounding errors of the evictions may turn a zero variance negative
+	return math.Max(w.m2/w.weight, 0)
+}
+
+// StdDev returns the weighted population standard deviation σ of the samples
+func (w *Window) StdDev() float64 {
+	return math.Sqrt(w.Variance())
+}
+
+// values returns the samples from the oldest to the latest
+func (w *Window) values() []float64 {
+	values := make([]float64, len(w.samples))
+	for i := range w.samples {
+		values[i] = w.samples[(w.head+i)%len(w.samples)].value
+	}
+	return values
+}
+
+// decay decays the weights to the time, a common factor does not change the mean
+func (w *Window) decay(at time.Time) {
+	if w.halfLife > 0 && at.After(w.latest) && !w.latest.IsZero() {
+		f := decayFactor(at.Sub(w.latest), w.halfLife)
+		w.weight *= f
+		w.m2 *= f
+	}
+	if at.After(w.latest) {
+		w.latest = at
+	}
+}
+
+func (w *Window) sampleWeight(s sample) float64 {
+	if w.halfLife <= 0 || !w.latest.After(s.at) {
+		return 1
+	}
+	return decayFactor(w.latest.Sub(s.at), w.halfLife)
+}
+
+func decayFactor(elapsed, halfLife time.Duration) float64 {
+	return math.Pow(0.5, float64(elapsed)/float64(halfLife))
+}
+
+// include is the weighted incremental update of West's variant of Welford's algorithm
+func (w *Window) include(value, weight float64) {
+	w.weight += weight
+	delta := value - w.mean
+	w.mean += delta * weight / w.weight
+	w.m2 += weight * delta * (value - w.mean)
+}
+
+// exclude reverses include for an evicted sample
+func (w *Window) exclude(value, weight float64) {
+	remaining := w.weight - weight
+	if remaining <= 0 {
+		w.weight, w.mean, w.m2 = 0, 0, 0
+		return
+	}
+	mean := (w.weight*w.mean - weight*value) / remaining
+	w.m2 -= weight * (value - w.mean) * (value - mean)
+	w.weight, w.mean = remaining, mean
+}
+
+func (w *Window) recompute() {
+	w.weight, w.mean, w.m2 = 0, 0, 0
+	for i := range w.samples {
+		s := w.samples[(w.head+i)%len(w.samples)]
+		w.include(s.value, w.sampleWeight(s))
+	}
+}
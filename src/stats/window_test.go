@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// populationStats is the two pass mean and standard deviation of the samples
+func populationStats(samples []float64) (mean, std float64) {
+	for _, v := range samples {
+		mean += v
+	}
+	mean /= float64(len(samples))
+	for _, v := range samples {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(samples)))
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestWindowEviction(t *testing.T) {
+	w := NewWindow(5, 0)
+	now := time.Now()
+	samples := []float64{}
+	for i := 0; i < 23; i++ {
+		v := float64((i*37)%11) + 0.5
+		w.Add(v, now.Add(time.Duration(i)*time.Second))
+		samples = append(samples, v)
+		if len(samples) > 5 {
+			samples = samples[1:]
+		}
+
+		mean, std := populationStats(samples)
+		if w.Count() != len(samples) || !near(w.Mean(), mean) || !near(w.StdDev(), std) {
+			t.Fatalf("sample %d expected mean %f σ %f over %d samples, got %f %f over %d",
+				i, mean, std, len(samples), w.Mean(), w.StdDev(), w.Count())
+		}
+	}
+	if cap(w.samples) != 5 {
+		t.Fatalf("the window is bounded, capacity %d", cap(w.samples))
+	}
+}
+
+func TestWindowDecay(t *testing.T) {
+	w := NewWindow(10, time.Minute)
+	now := time.Now()
+	w.Add(100, now)
+	w.Add(0, now.Add(time.Minute))
+	// the first sample has half the weight of the second one
+	if !near(w.Mean(), 100.0/3) {
+		t.Fatalf("expected the decayed mean %f, got %f", 100.0/3, w.Mean())
+	}
+
+	// the old samples are forgotten, they weigh 2^-60 after an hour
+	for i := 0; i < 5; i++ {
+		w.Add(10, now.Add(time.Hour))
+	}
+	if math.Abs(w.Mean()-10) > 1e-6 || w.StdDev() > 1e-3 {
+		t.Fatalf("expected the mean and σ of the recent samples, got %f %f", w.Mean(), w.StdDev())
+	}
+
+	// the eviction of a decayed sample keeps the statistics of the remaining samples
+	w = NewWindow(2, time.Minute)
+	w.Add(100, now)
+	w.Add(4, now.Add(time.Minute))
+	w.Add(6, now.Add(time.Minute))
+	if !near(w.Mean(), 5) || !near(w.StdDev(), 1) {
+		t.Fatalf("expected mean 5 and σ 1 after the eviction, got %f %f", w.Mean(), w.StdDev())
+	}
+}
+
+func TestWindowedStandardDev(t *testing.T) {
+	std := NewWindowedStandardDeviation("Test", WindowOptions{Size: 50, MinSamples: 3})
+	std.Push(10)
+	if _, _, within := std.Push(1000); !within {
+		t.Fatal("expect no evaluation under the minimum samples")
+	}
+	for i := 0; i < 50; i++ {
+		std.Add(10)
+	}
+	if std.Count() != 50 || std.Std > 1e-6 || !near(std.Mean, 10) {
+		t.Fatalf("expect the spike evicted from the window, mean %f σ %f", std.Mean, std.Std)
+	}
+	if _, _, within := std.Push(1000); within {
+		t.Fatal("expect a spike over the stable baseline")
+	}
+}
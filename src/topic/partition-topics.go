@@ -13,6 +13,7 @@ import (
 
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
 	"github.com/kafkaesque-io/pulsar-monitor/src/util"
 )
 
@@ -149,11 +150,20 @@ func (pt *PartitionTopics) VerifyPartitionTopic() error {
 }
 
 // TestPartitionTopic sends multiple messages and to be verified by multiple consumers
-func (pt *PartitionTopics) TestPartitionTopic(client pulsar.Client) (time.Duration, error) {
+// It waits for the messages until the context is done, 60 seconds if the context has no deadline.
+// The run is traced with the spans of the producer create, every message send and the consumers.
+func (pt *PartitionTopics) TestPartitionTopic(ctx context.Context, client pulsar.Client) (latency time.Duration, err error) {
+	// the consumers are stopped when the test returns
+	ctx, cancel := util.WithDefaultTimeout(ctx, 60*time.Second)
+	defer cancel()
+	ctx, span := otlp.Start(ctx, "partition topic latency",
+		otlp.String("pulsar.topic", pt.TopicFullname), otlp.Int("partitions", pt.NumberOfPartitions))
+	defer func() { span.EndWithError(err) }()
 
 	// notify the main thread with the latency to complete the exit of all consumers
-	completeChan := make(chan *util.ConsumerResult, pt.NumberOfPartitions)
-	defer close(completeChan)
+	// every consumer and every send callback reports at most once, the channel is not closed
+	// since they may still report after the test returns
+	completeChan := make(chan *util.ConsumerResult, 2*pt.NumberOfPartitions)
 
 	partitionTopicSuffix := "-partition-"
 	// prepare the message
@@ -163,15 +173,17 @@ func (pt *PartitionTopics) TestPartitionTopic(client pulsar.Client) (time.Durati
 	for i := 0; i < pt.NumberOfPartitions; i++ {
 		topicName := pt.TopicFullname + partitionTopicSuffix + strconv.Itoa(i)
 		pt.log.Infof("subscribe to partition topic %s wait on message %s", topicName, message)
-		go util.VerifyMessageByPulsarConsumer(client, topicName, message, completeChan)
+		go util.VerifyMessageByPulsarConsumer(ctx, client, topicName, message, completeChan)
 	}
 
 	pt.log.Infof("create a topic producer %s", pt.TopicFullname)
 	// create a pulsar producer
+	_, producerSpan := otlp.Start(ctx, "producer create")
 	producer, err := client.CreateProducer(pulsar.ProducerOptions{
 		Topic:           pt.TopicFullname,
 		DisableBatching: true,
 	})
+	producerSpan.EndWithError(err)
 	if err != nil {
 		return 0, err
 	}
@@ -183,16 +195,17 @@ func (pt *PartitionTopics) TestPartitionTopic(client pulsar.Client) (time.Durati
 	// producer sends multiple messages
 	start := time.Now()
 	for i := 0; i < pt.NumberOfPartitions; i++ {
-		ctx := context.Background()
-
 		// Create a different message to send asynchronously
+		_, sendSpan := otlp.Start(ctx, "send", otlp.Int("partition.key", i))
 		msg := pulsar.ProducerMessage{
-			Payload: []byte(message),
-			Key:     "partitionkey" + strconv.Itoa(i),
+			Payload:    []byte(message),
+			Key:        "partitionkey" + strconv.Itoa(i),
+			Properties: map[string]string{"traceparent": sendSpan.TraceParent()},
 		}
 
 		// Attempt to send message asynchronously and handle the response
 		producer.SendAsync(ctx, &msg, func(messageId pulsar.MessageID, msg *pulsar.ProducerMessage, err error) {
+			sendSpan.EndWithError(err)
 			if err != nil {
 				log.Errorf("failed to send message over partition topic , error: %v", err)
 				errMsg := fmt.Sprintf("fail to instantiate Pulsar client: %v", err)
@@ -208,8 +221,6 @@ func (pt *PartitionTopics) TestPartitionTopic(client pulsar.Client) (time.Durati
 
 	receivedCounter := 0
 	successfulCounter := 0
-	ticker := time.NewTicker(60 * time.Second)
-	defer ticker.Stop()
 	for receivedCounter < pt.NumberOfPartitions {
 		select {
 		case signal := <-completeChan:
@@ -226,7 +237,7 @@ func (pt *PartitionTopics) TestPartitionTopic(client pulsar.Client) (time.Durati
 			if successfulCounter >= pt.NumberOfPartitions {
 				return time.Since(start), nil
 			}
-		case <-ticker.C:
+		case <-ctx.Done():
 			return 0, fmt.Errorf("received %d msg with %d successful delivery but timed out to receive all %d messages",
 				receivedCounter, successfulCounter, pt.NumberOfPartitions)
 		}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/apex/log"
+	"github.com/kafkaesque-io/pulsar-monitor/src/otlp"
 )
 
 // ConsumerResult is Pulsar Consumer result for channel communication
@@ -19,9 +20,15 @@ type ConsumerResult struct {
 }
 
 // VerifyMessageByPulsarConsumer instantiates a Pulsar consumer and verifies an expected message
-func VerifyMessageByPulsarConsumer(client pulsar.Client, topicName, expectedMessage string, completeChan chan *ConsumerResult) error {
+// It waits for the message until the context is done, 90 seconds if the context has no deadline.
+// The subscribe, receive and ack are traced as the child spans of the span in the context.
+func VerifyMessageByPulsarConsumer(ctx context.Context, client pulsar.Client, topicName, expectedMessage string, completeChan chan *ConsumerResult) error {
+	ctx, cancel := WithDefaultTimeout(ctx, 90*time.Second)
+	defer cancel()
+
 	topicParts := strings.Split(topicName, "/")
 	subscriptionName := "partition-sub" + topicParts[len(topicParts)-1]
+	_, subscribeSpan := otlp.Start(ctx, "subscribe", otlp.String("pulsar.topic", topicName))
 	consumer, err := client.Subscribe(pulsar.ConsumerOptions{
 		Topic:                       topicName,
 		SubscriptionName:            subscriptionName,
@@ -29,6 +36,7 @@ func VerifyMessageByPulsarConsumer(client pulsar.Client, topicName, expectedMess
 		ReceiverQueueSize:           1,
 		SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
 	})
+	subscribeSpan.EndWithError(err)
 	if err != nil {
 		log.Errorf("failed to created partition topic consumer, error: %v", err)
 		return err
@@ -37,21 +45,24 @@ func VerifyMessageByPulsarConsumer(client pulsar.Client, topicName, expectedMess
 
 	receivedCount := 0
 	receiveTimeout := 60 * time.Second
-	start := time.Now()
-	for time.Since(start) < 90*time.Second { // TODO: this should be passed in as timeout parameter
-		cCtx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	for ctx.Err() == nil {
+		cCtx, cancel := context.WithTimeout(ctx, receiveTimeout)
 		defer cancel()
 
 		log.Infof("%s wait to receive on message count %d", topicName, receivedCount)
 		receivedCount++
+		_, receiveSpan := otlp.Start(ctx, "receive", otlp.String("pulsar.topic", topicName))
 		msg, err := consumer.Receive(cCtx)
+		receiveSpan.EndWithError(err)
 		if err != nil {
 			completeChan <- &ConsumerResult{
 				Err: fmt.Errorf("consumer Receive() error: %v", err),
 			}
 			break
 		}
+		_, ackSpan := otlp.Start(ctx, "ack")
 		consumer.Ack(msg)
+		ackSpan.End()
 		if expectedMessage == string(msg.Payload()) {
 			log.Infof("expected message received by %s", topicName)
 			completeChan <- &ConsumerResult{
@@ -2,6 +2,7 @@ package util
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kafkaesque-io/pulsar-monitor/src/stats"
@@ -20,10 +22,16 @@ var (
 	// used to generate random payload size
 	letters = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
-	// key is the cluster name
-	standardDeviationStore = make(map[string]*stats.StandardDeviation)
+	// key is the probe
+	detectorStore = make(map[string]storedDetector)
+	detectorLock  sync.Mutex
 )
 
+type storedDetector struct {
+	opts     stats.DetectorOptions
+	detector stats.Detector
+}
+
 // ResponseErr - Error struct for Http response
 type ResponseErr struct {
 	Error string `json:"error"`
@@ -170,6 +178,14 @@ func TimeDuration(configV, defaultV int, timeUnit time.Duration) time.Duration {
 
 }
 
+// WithDefaultTimeout returns a context with the default timeout unless the parent context has a deadline
+func WithDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 // StrContains check if a string is contained in an array of string
 func StrContains(strs []string, str string) bool {
 	for _, v := range strs {
@@ -218,15 +234,34 @@ func StrToInt(str string, defaultNum int) int {
 	return defaultNum
 }
 
-// GetStdBucket gets the standard deviation bucket
-func GetStdBucket(key string) *stats.StandardDeviation {
-	stdVerdict, ok := standardDeviationStore[key]
-	if !ok {
-		std := stats.NewStandardDeviation(key)
-		standardDeviationStore[key] = &std
-		return &std
+// GetDetector gets the anomaly detector, it is created on first use or recreated if the options change
+func GetDetector(key string, opts stats.DetectorOptions) (stats.Detector, error) {
+	detectorLock.Lock()
+	defer detectorLock.Unlock()
+	if d, ok := detectorStore[key]; ok && sameDetectorOptions(d.opts, opts) {
+		return d.detector, nil
 	}
-	return stdVerdict
+	detector, err := stats.NewDetector(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	detectorStore[key] = storedDetector{opts: opts, detector: detector}
+	return detector, nil
+}
+
+// DeleteDetector deletes the anomaly detector and its baseline
+func DeleteDetector(key string) {
+	detectorLock.Lock()
+	defer detectorLock.Unlock()
+	delete(detectorStore, key)
+}
+
+// sameDetectorOptions compares the options, the time zones are compared by name
+// since every loaded time zone is a different location
+func sameDetectorOptions(a, b stats.DetectorOptions) bool {
+	aLoc, bLoc := a.Location, b.Location
+	a.Location, b.Location = nil, nil
+	return a == b && aLoc.String() == bLoc.String()
 }
 
 // TokenizeTopicFullName tokenizes a topic full name into persistent, tenant, namespace, and topic name.
@@ -275,6 +310,14 @@ func MinInt(a, b int) int {
 	return a
 }
 
+// MaxInt returns a larger integer of two integers
+func MaxInt(a, b int) int {
+	if a >= b {
+		return a
+	}
+	return b
+}
+
 // TopicFnToURL converts fully qualified topic name to url route
 func TopicFnToURL(topicFn string) (string, error) {
 	// non-persistent://tenant/namesapce/topic